@@ -3,9 +3,11 @@ package main
 import (
 	"context"
 	"fmt"
-	"log"
+	"log/slog"
 	"math/rand"
-	"time"
+	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/PavelRadostev/toolkit/pkg/bus"
 	"github.com/PavelRadostev/toolkit/pkg/config"
@@ -103,23 +105,17 @@ func (a *AllGGISImportTemplatesQueryHandler) Handle(ctx context.Context) (any, e
 	}, nil
 }
 
-//IsPlanApprovedQueryHandler
-
-type IsPlanApprovedQueryHandler struct {
+// IsPlanApprovedQuery is registered with the typed bus.Handle API, no constructor needed
+type IsPlanApprovedQuery struct {
 	EnterpriseID EnterpriseId `cbor:"enterprise_id"`
-	Repository   bus.Repository
 }
 
-func NewIsPlanApprovedQueryFromCBOR(data []byte, repo bus.Repository) (bus.Subscriber, error) {
-	var handler IsPlanApprovedQueryHandler
-	if err := cbor.Unmarshal(data, &handler); err != nil {
-		return nil, err
-	}
-	handler.Repository = repo
-	return &handler, nil
+// String returns the stream name of the query, so it can be sent with bus.Call
+func (q IsPlanApprovedQuery) String() string {
+	return "vist_domain.query.pit.plan.IsPlanApprovedQuery"
 }
 
-func (i *IsPlanApprovedQueryHandler) Handle(ctx context.Context) (any, error) {
+func HandleIsPlanApprovedQuery(ctx context.Context, q IsPlanApprovedQuery) (bool, error) {
 
 	fmt.Printf("HandlingIsPlanApprovedQuery")
 
@@ -127,14 +123,14 @@ func (i *IsPlanApprovedQueryHandler) Handle(ctx context.Context) (any, error) {
 }
 
 func main() {
+	cfg := config.Load()
+	logger := cfg.Log.NewLogger()
+	slog.SetDefault(logger)
 
 	migrator.Execute()
 
-	ctx := context.Background()
-
-	fmt.Println("Hello, World!")
-	cfg := config.Load()
-	fmt.Println(cfg)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
 	redisClient := redis.NewClient(&redis.Options{
 		Addr:     cfg.Redis.Addr,
@@ -143,11 +139,13 @@ func main() {
 	})
 
 	busInstance := bus.NewBus(redisClient, ctx)
+	busInstance.SetLogger(logger)
+	cfg.Bus.Apply(busInstance)
 	factory := bus.NewHandlerFactory()
 
 	// Register handlers in factory
 	factory.RegisterHandler("vist_domain.query.ggis_import.AllGGISImportTemplatesQuery", NewAllGGISImportTemplatesQueryFromCBOR)
-	factory.RegisterHandler("vist_domain.query.pit.plan.IsPlanApprovedQuery", NewIsPlanApprovedQueryFromCBOR)
+	bus.Handle(factory, IsPlanApprovedQuery{}.String(), HandleIsPlanApprovedQuery)
 
 	// Register repositories in factory (example - can be nil if not needed)
 	// factory.RegisterRepository("vist_domain.query.ggis_import.AllGGISImportTemplatesQuery", someRepository)
@@ -160,15 +158,16 @@ func main() {
 	busInstance.Register("vist_domain.query.ggis_import.AllGGISImportTemplatesQuery")
 	busInstance.Register("vist_domain.query.pit.plan.IsPlanApprovedQuery")
 
-	busInstance.Run()
-
 	pool, err := db.NewPool(ctx, cfg)
 	if err != nil {
-		log.Fatalf("Failed to create database pool: %v", err)
+		logger.Error("Failed to create database pool", "error", err)
+		os.Exit(1)
 	}
 
 	defer pool.Close()
 
-	time.Sleep(time.Second * 600)
-
+	// Run blocks until SIGINT/SIGTERM and drains in-flight messages before returning
+	if err := busInstance.Run(ctx); err != nil {
+		logger.Error("Bus stopped with error", "error", err)
+	}
 }
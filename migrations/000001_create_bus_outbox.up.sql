@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS bus_outbox (
+    id           BIGSERIAL PRIMARY KEY,
+    stream       TEXT        NOT NULL,
+    request_id   TEXT        NOT NULL,
+    request      BYTEA       NOT NULL,
+    txid         xid8        NOT NULL DEFAULT pg_current_xact_id(),
+    created_at   TIMESTAMPTZ NOT NULL DEFAULT now(),
+    published_at TIMESTAMPTZ,
+    attempts     INTEGER     NOT NULL DEFAULT 0,
+    last_error   TEXT
+);
+
+CREATE INDEX IF NOT EXISTS bus_outbox_pending_idx ON bus_outbox (txid, id) WHERE published_at IS NULL;
+CREATE INDEX IF NOT EXISTS bus_outbox_published_at_idx ON bus_outbox (published_at) WHERE published_at IS NOT NULL;
@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS bus_inbox (
+    stream       TEXT        NOT NULL,
+    request_id   TEXT        NOT NULL,
+    response     BYTEA,
+    processed_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (stream, request_id)
+);
+
+CREATE INDEX IF NOT EXISTS bus_inbox_processed_at_idx ON bus_inbox (processed_at);
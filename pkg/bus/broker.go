@@ -0,0 +1,73 @@
+package bus
+
+import (
+	"context"
+	"time"
+)
+
+// Entry is a single stream entry as stored by the transport
+type Entry struct {
+	ID     string
+	Values map[string]interface{}
+}
+
+// Transport defines the stream and response-list operations used by Bus
+// RedisTransport talks to Redis, MemoryTransport keeps everything in process
+type Transport interface {
+	// Add appends an entry to the stream and returns its ID
+	// A positive maxLen trims the stream to about that many entries, zero keeps every entry
+	Add(ctx context.Context, stream string, values map[string]interface{}, maxLen int64) (string, error)
+	// Delete removes entries from the stream
+	Delete(ctx context.Context, stream string, ids ...string) error
+	// Trim removes entries with IDs lower than minID, approximately, and returns how many were removed
+	Trim(ctx context.Context, stream, minID string) (int64, error)
+	// TrimFloor returns the lowest entry ID a consumer group of the stream still needs:
+	// its oldest pending entry or, with nothing pending, its last delivered entry
+	// Returns an empty ID when the stream has no consumer groups
+	TrimFloor(ctx context.Context, stream string) (string, error)
+
+	// Read reads up to count entries with IDs greater than after, without a consumer group
+	// It blocks up to block and returns no entries and no error on timeout
+	Read(ctx context.Context, stream, after string, count int, block time.Duration) ([]Entry, error)
+	// LastID returns the ID of the last entry in the stream, "0-0" when the stream is empty or missing
+	LastID(ctx context.Context, stream string) (string, error)
+
+	// CreateGroup creates the consumer group and the stream if they do not exist
+	// start is the ID after which entries are delivered, "$" means only new entries
+	CreateGroup(ctx context.Context, stream, group, start string) error
+	// ReadGroup reads up to count entries not yet delivered to the group
+	// It blocks up to block and returns no entries and no error on timeout
+	ReadGroup(ctx context.Context, stream, group, consumer string, count int, block time.Duration) ([]Entry, error)
+	// GroupLag returns the number of entries not yet delivered to the group, -1 when it cannot be determined
+	GroupLag(ctx context.Context, stream, group string) (int64, error)
+	// Ack removes entries from the pending entries list of the group
+	Ack(ctx context.Context, stream, group string, ids ...string) error
+	// Claim transfers pending entries idle for at least minIdle to the consumer
+	// It scans from start and returns the cursor for the next call, "0-0" when the scan is complete
+	Claim(ctx context.Context, stream, group, consumer string, minIdle time.Duration, start string, count int) ([]Entry, string, error)
+	// Touch resets the idle time of pending entries and assigns them to the consumer,
+	// so entries still being handled are not claimed by other consumers
+	Touch(ctx context.Context, stream, group, consumer string, ids ...string) error
+
+	// PushResponse appends a response to the list keyed by the request ID and sets the list expiry
+	PushResponse(ctx context.Context, key string, data []byte, ttl time.Duration) error
+	// PopResponse removes the first response from the list, blocking up to timeout
+	// Returns nil data and no error on timeout
+	PopResponse(ctx context.Context, key string, timeout time.Duration) ([]byte, error)
+
+	// CancelRequest marks the request as cancelled for ttl and notifies every WatchCancellations subscriber
+	CancelRequest(ctx context.Context, requestID string, ttl time.Duration) error
+	// RequestCancelled reports whether the request is marked as cancelled
+	RequestCancelled(ctx context.Context, requestID string) (bool, error)
+	// WatchCancellations delivers IDs of requests cancelled after the call until ctx is done
+	// A closed channel means the subscription ended, e.g. the connection failed, and must be renewed
+	WatchCancellations(ctx context.Context) (<-chan string, error)
+
+	// Schedule parks an entry for the stream until at
+	// maxLen is applied like in Add when the entry is appended to the stream
+	Schedule(ctx context.Context, stream string, values map[string]interface{}, at time.Time, maxLen int64) error
+	// MoveDue takes up to count entries scheduled at or before now off the schedule and appends them to their streams
+	// Returns how many were moved and how many were parked because their stream rejected them
+	// Concurrent callers never take the same entry; a parked entry is kept for inspection and not retried
+	MoveDue(ctx context.Context, now time.Time, count int) (moved, parked int, err error)
+}
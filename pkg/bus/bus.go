@@ -4,17 +4,43 @@ import (
 	"context"
 	"crypto/rand"
 	"encoding/hex"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
+	"runtime/debug"
+	"slices"
 	"sync"
 	"time"
 
-	"github.com/redis/go-redis/v9"
+	"github.com/fxamacker/cbor/v2"
 )
 
 const (
 	// DefaultTimeout in seconds for requests
 	DefaultTimeout = 300
+
+	// responsePollInterval bounds a single response wait so that Execute
+	// notices context cancellation without waiting for the full timeout
+	responsePollInterval = time.Second
+
+	// responseTTL is how long an unread response stays in the response list
+	responseTTL = 30 * time.Second
+
+	// readBlockTimeout bounds a single group read so that the stream
+	// loop notices bus shutdown
+	readBlockTimeout = 5 * time.Second
+
+	// DefaultShutdownTimeout is the grace period for in-flight messages on shutdown
+	DefaultShutdownTimeout = 30 * time.Second
+)
+
+var (
+	// ErrBusRunning is returned by Run when the bus is already running
+	ErrBusRunning = errors.New("bus is already running")
+	// ErrNoStreams is returned by Run when no handlers are registered in the factory
+	ErrNoStreams = errors.New("no handlers registered in factory")
+	// ErrRequestTimeout is sent to the caller when the request deadline passed before it was handled
+	ErrRequestTimeout = errors.New("request timed out")
 )
 
 // Subscriber defines the interface for message consumers
@@ -32,37 +58,90 @@ type Publisher interface {
 type Response struct {
 	Data  any
 	Error error
+	// result holds the raw CBOR result when the response came over the wire
+	result []byte
 }
 
-// RedisClient defines the interface for Redis operations used by Bus
-type RedisClient interface {
-	XAdd(ctx context.Context, args *redis.XAddArgs) *redis.StringCmd
-	XRead(ctx context.Context, args *redis.XReadArgs) *redis.XStreamSliceCmd
-	Pipeline() redis.Pipeliner
+// Decode decodes the response data into the target value
+// Uses the raw CBOR result when available, otherwise re-encodes Data
+func (r Response) Decode(target any) error {
+	data := r.result
+	if data == nil {
+		if r.Data == nil {
+			return nil
+		}
+		encoded, err := cbor.Marshal(r.Data)
+		if err != nil {
+			return fmt.Errorf("failed to encode response data: %w", err)
+		}
+		data = encoded
+	}
+	return cbor.Unmarshal(data, target)
 }
 
-// Bus is the main message bus implementation using Redis streams
+// Bus is the main message bus implementation on top of a stream Transport
 type Bus struct {
-	redis      RedisClient
-	serializer BrokerSerialize
-	factory    *HandlerFactory
-	mu         sync.RWMutex
-	responses  map[string]chan Response
-	responseMu sync.RWMutex
-	ctx        context.Context
-	cancel     context.CancelFunc
-	wg         sync.WaitGroup
+	transport   Transport
+	serializer  BrokerSerialize
+	factory     *HandlerFactory
+	group       string
+	consumer    string
+	claim       ClaimPolicy
+	streams     map[string]streamConfig
+	limiter     chan struct{}
+	grace       time.Duration
+	errRegistry *ErrorRegistry
+	// scheduleInterval is how often Run moves due scheduled messages, zero disables it
+	scheduleInterval time.Duration
+	// retention applies to streams without an entry in streamRetention
+	retention       RetentionPolicy
+	streamRetention map[string]RetentionPolicy
+	metrics         Metrics
+	tracer          Tracer
+	logger          *slog.Logger
+	inflight        inflightRequests
+	// handlerMiddleware wraps every Handle call, publishMiddleware every Execute and Emit
+	handlerMiddleware []HandlerMiddleware
+	publishMiddleware []PublishMiddleware
+	mu                sync.RWMutex
+	// parent bounds the lifetime of the bus, Run stops when it is done
+	parent context.Context
+	// ctx is cancelled when the bus stops reading new messages
+	ctx context.Context
+	// handleCtx is passed to handlers and cancelled when the grace period expires
+	handleCtx context.Context
+	cancel    context.CancelFunc
+	done      chan struct{}
+	wg        sync.WaitGroup
 }
 
 // NewBus creates a new Bus instance with the provided Redis client
 // Uses RedisBrokerSerialize as default serializer
+// The context bounds the lifetime of the bus: Run stops when it is done
 func NewBus(redis RedisClient, ctx context.Context) *Bus {
+	return NewBusWithTransport(NewRedisTransport(redis), ctx)
+}
+
+// NewBusWithTransport creates a new Bus instance on top of the provided transport
+// Use NewMemoryTransport to run handlers without Redis
+func NewBusWithTransport(transport Transport, ctx context.Context) *Bus {
 	return &Bus{
-		redis:      redis,
-		serializer: NewRedisBrokerSerialize(),
-		factory:    NewHandlerFactory(),
-		responses:  make(map[string]chan Response),
-		ctx:        ctx,
+		transport:        transport,
+		serializer:       NewRedisBrokerSerialize(),
+		factory:          NewHandlerFactory(),
+		group:            DefaultConsumerGroup,
+		consumer:         defaultConsumerName(),
+		claim:            DefaultClaimPolicy(),
+		streams:          make(map[string]streamConfig),
+		grace:            DefaultShutdownTimeout,
+		errRegistry:      DefaultErrors,
+		metrics:          nopMetrics{},
+		tracer:           propagationTracer{},
+		scheduleInterval: DefaultSchedulerInterval,
+		streamRetention:  make(map[string]RetentionPolicy),
+		parent:           ctx,
+		ctx:              ctx,
+		handleCtx:        ctx,
 	}
 }
 
@@ -72,13 +151,39 @@ func (b *Bus) SetSerializer(serializer BrokerSerialize) {
 }
 
 // Register registers a stream name and uses the HandlerFactory to create handlers
-func (b *Bus) Register(streamName string) {
+// Options configure how the stream is consumed, e.g. its retry policy
+func (b *Bus) Register(streamName string, opts ...StreamOption) {
 	b.mu.Lock()
 	defer b.mu.Unlock()
-	if !b.factory.HasHandler(streamName) {
-		log.Printf("Warning: No handler registered in factory for stream: %s", streamName)
+	if !b.factory.HasHandler(streamName) && !b.factory.HasEventHandlers(streamName) {
+		orDefault(b.logger).Warn("No handler registered in factory for stream", LogKeyStream, streamName)
 	}
-	log.Printf("Registered stream: %s", streamName)
+	cfg := defaultStreamConfig()
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	b.streams[streamName] = cfg
+	orDefault(b.logger).Debug("Registered stream", LogKeyStream, streamName)
+}
+
+// SetConcurrencyLimit caps the number of messages handled concurrently across all streams
+// Zero or a negative value removes the limit
+func (b *Bus) SetConcurrencyLimit(n int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if n <= 0 {
+		b.limiter = nil
+		return
+	}
+	b.limiter = make(chan struct{}, n)
+}
+
+// SetShutdownTimeout sets how long Run waits for in-flight messages after it stops reading
+// Handlers still running after the timeout get their context cancelled
+func (b *Bus) SetShutdownTimeout(timeout time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.grace = timeout
 }
 
 // SetFactory sets the HandlerFactory for the Bus
@@ -86,7 +191,6 @@ func (b *Bus) SetFactory(factory *HandlerFactory) {
 	b.mu.Lock()
 	defer b.mu.Unlock()
 	b.factory = factory
-	log.Printf("HandlerFactory set for Bus")
 }
 
 // generateRequestID generates a unique request ID
@@ -97,195 +201,504 @@ func generateRequestID() string {
 }
 
 // Execute sends a message and waits for a response
-func (b *Bus) Execute(ctx context.Context, pub Publisher) (Response, error) {
-	streamName := pub.String()
-	requestID := generateRequestID()
+// Options set the response timeout and whether a response is requested at all
+func (b *Bus) Execute(ctx context.Context, pub Publisher, opts ...CallOption) (Response, error) {
+	options := newCallOptions(ctx, true, opts)
 
-	// Serialize the publisher payload
-	payload, err := pub.Serialize()
+	transportReq, err := newRequest(pub, options)
 	if err != nil {
-		return Response{}, fmt.Errorf("failed to serialize publisher: %w", err)
+		return Response{}, err
 	}
 
-	// Create TransportRequest matching Python's format
-	transportReq := TransportRequest{
-		CreatedTimestamp: float64(time.Now().UnixNano()) / 1e9,
-		RequestID:        requestID,
-		Message:          []byte{0xa0}, // Empty CBOR map
-		Properties:       payload,
-		ReturnResult:     1, // Request response
-		Timeout:          DefaultTimeout,
-	}
+	send := b.publishChain(func(ctx context.Context, streamName string, req *TransportRequest) (Response, error) {
+		if err := b.add(ctx, streamName, req); err != nil {
+			return Response{}, err
+		}
+		if !req.NeedsResponse() {
+			return Response{}, nil
+		}
+		// Wait for response with timeout
+		waitCtx, span := b.tracing().Start(ctx, streamName+" wait", SpanKindInternal, spanAttributes(streamName, "wait", req)...)
+		resp, err := b.waitResponse(waitCtx, req.RequestID, options.timeout)
+		span.End(errors.Join(err, resp.Error))
+		if err != nil && ctx.Err() != nil {
+			// Nobody waits for the result anymore, let the handler stop early
+			b.cancelRequest(ctx, streamName, req)
+		}
+		return resp, err
+	})
+	return send(ctx, pub.String(), transportReq)
+}
 
-	// Serialize using broker serializer
-	values, err := b.serializer.Serialize(&transportReq)
+// waitResponse blocks on the response list keyed by the request ID
+// The handler may run in any process, so the list is the only reply channel
+func (b *Bus) waitResponse(ctx context.Context, requestID string, timeout time.Duration) (Response, error) {
+	transportResp, err := b.waitTransportResponse(ctx, requestID, time.Now().Add(timeout))
 	if err != nil {
-		return Response{}, fmt.Errorf("failed to serialize transport request: %w", err)
+		return Response{}, err
 	}
+	return transportResp.ResponseWith(b.errorRegistry()), nil
+}
 
-	// Create response channel
-	responseCh := make(chan Response, 1)
-	b.responseMu.Lock()
-	b.responses[requestID] = responseCh
-	b.responseMu.Unlock()
+// waitTransportResponse pops the next response from the list keyed by the request ID until the deadline
+func (b *Bus) waitTransportResponse(ctx context.Context, requestID string, deadline time.Time) (*TransportResponse, error) {
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, fmt.Errorf("context cancelled: %w", err)
+		}
 
-	// Clean up response channel after timeout or completion
-	defer func() {
-		b.responseMu.Lock()
-		delete(b.responses, requestID)
-		close(responseCh)
-		b.responseMu.Unlock()
-	}()
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("timeout waiting for response (request_id: %s)", requestID)
+		}
 
-	// Add message to stream
-	msgID, err := b.redis.XAdd(ctx, &redis.XAddArgs{
-		Stream: streamName,
-		Values: values,
-	}).Result()
-	if err != nil {
-		return Response{}, fmt.Errorf("failed to add message to stream: %w", err)
+		data, err := b.transport.PopResponse(ctx, requestID, responsePollInterval)
+		if err != nil {
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				return nil, fmt.Errorf("context cancelled: %w", ctxErr)
+			}
+			return nil, fmt.Errorf("failed to read response: %w", err)
+		}
+		if data == nil {
+			continue
+		}
+
+		transportResp, err := DecodeTransportResponse(data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode transport response: %w", err)
+		}
+		return transportResp, nil
 	}
+}
 
-	log.Printf("Sent message to stream %s with ID %s, request_id: %s", streamName, msgID, requestID)
+// Emit sends a message without waiting for a response
+func (b *Bus) Emit(ctx context.Context, pub Publisher, opts ...CallOption) error {
+	options := newCallOptions(ctx, false, opts)
 
-	// Wait for response with timeout
-	timeout := time.Duration(DefaultTimeout) * time.Second
-	select {
-	case response := <-responseCh:
-		return response, nil
-	case <-ctx.Done():
-		return Response{}, fmt.Errorf("context cancelled: %w", ctx.Err())
-	case <-time.After(timeout):
-		return Response{}, fmt.Errorf("timeout waiting for response (request_id: %s)", requestID)
+	transportReq, err := newRequest(pub, options)
+	if err != nil {
+		return err
 	}
+
+	return b.EmitRequest(ctx, pub.String(), transportReq)
 }
 
-// Emit sends a message without waiting for a response
-func (b *Bus) Emit(ctx context.Context, pub Publisher) error {
-	streamName := pub.String()
-	requestID := generateRequestID()
+// EmitRequest sends a prepared TransportRequest to the stream without waiting for a response
+// Used to deliver requests built earlier with NewRequest, e.g. by the outbox relay
+func (b *Bus) EmitRequest(ctx context.Context, streamName string, req *TransportRequest) error {
+	send := b.publishChain(func(ctx context.Context, streamName string, req *TransportRequest) (Response, error) {
+		return Response{}, b.add(ctx, streamName, req)
+	})
+	_, err := send(ctx, streamName, req)
+	return err
+}
+
+// NewRequest builds the TransportRequest Emit would send for the publisher
+// The request can be stored and sent later with EmitRequest
+func NewRequest(pub Publisher, opts ...CallOption) (*TransportRequest, error) {
+	return newRequest(pub, newCallOptions(context.Background(), false, opts))
+}
 
+// newRequest builds a TransportRequest for the publisher
+func newRequest(pub Publisher, options callOptions) (*TransportRequest, error) {
 	// Serialize the publisher payload
 	payload, err := pub.Serialize()
 	if err != nil {
-		return fmt.Errorf("failed to serialize publisher: %w", err)
+		return nil, fmt.Errorf("failed to serialize publisher: %w", err)
+	}
+	message, err := EncodeMessageInfo(pub)
+	if err != nil {
+		return nil, err
 	}
 
 	// Create TransportRequest matching Python's format
-	transportReq := TransportRequest{
+	return &TransportRequest{
 		CreatedTimestamp: float64(time.Now().UnixNano()) / 1e9,
-		RequestID:        requestID,
-		Message:          []byte{0xa0}, // Empty CBOR map
+		RequestID:        generateRequestID(),
+		Message:          message,
 		Properties:       payload,
-		ReturnResult:     0, // No response needed
-		Timeout:          DefaultTimeout,
-	}
+		ReturnResult:     options.returnResultFlag(),
+		Timeout:          options.timeoutSeconds(),
+	}, nil
+}
+
+// add serializes the TransportRequest and adds it to the stream
+func (b *Bus) add(ctx context.Context, streamName string, req *TransportRequest) (err error) {
+	span := b.startPublishSpan(ctx, streamName, "publish", req)
+	defer func() { span.End(err) }()
 
 	// Serialize using broker serializer
-	values, err := b.serializer.Serialize(&transportReq)
+	values, err := b.serializer.Serialize(req)
 	if err != nil {
 		return fmt.Errorf("failed to serialize transport request: %w", err)
 	}
 
 	// Add message to stream
-	msgID, err := b.redis.XAdd(ctx, &redis.XAddArgs{
-		Stream: streamName,
-		Values: values,
-	}).Result()
+	msgID, err := b.transport.Add(ctx, streamName, values, b.retentionPolicy(streamName).MaxLen)
 	if err != nil {
 		return fmt.Errorf("failed to add message to stream: %w", err)
 	}
 
-	log.Printf("Emitted message to stream %s with ID %s, request_id: %s", streamName, msgID, requestID)
+	b.metricsSink().MessagePublished(streamName)
+	b.log().Debug("Sent message", LogKeyStream, streamName, LogKeyRedisMessageID, msgID, LogKeyRequestID, req.RequestID)
 	return nil
 }
 
-// Run starts listening to all registered streams and processing messages
-func (b *Bus) Run() {
-	b.mu.RLock()
+// Run listens to all registered streams and processes messages until ctx is done or Stop is called
+// On shutdown it stops reading, waits for in-flight messages up to the shutdown timeout
+// and returns once every stream goroutine has exited
+// Messages whose handlers were cancelled stay pending and are reclaimed by other consumers
+func (b *Bus) Run(ctx context.Context) error {
+	b.mu.Lock()
+	if b.done != nil {
+		b.mu.Unlock()
+		return ErrBusRunning
+	}
 	streams := b.factory.GetStreams()
-	b.mu.RUnlock()
-
 	if len(streams) == 0 {
-		log.Println("No handlers registered in factory, nothing to run")
-		return
+		b.mu.Unlock()
+		return ErrNoStreams
+	}
+	if err := b.factory.validate(); err != nil {
+		b.mu.Unlock()
+		return err
+	}
+	if b.group == DefaultConsumerGroup && slices.ContainsFunc(streams, b.factory.HasEventHandlers) {
+		orDefault(b.logger).Warn("Event streams are read with the default consumer group, set a per-service group with SetConsumerGroup to receive every event")
+	}
+
+	runCtx, cancel := context.WithCancel(ctx)
+	stopParent := context.AfterFunc(b.parent, cancel)
+	// Handlers outlive the read loop for the grace period
+	handleCtx, cancelHandle := context.WithCancel(context.WithoutCancel(runCtx))
+
+	b.ctx = runCtx
+	b.handleCtx = handleCtx
+	b.cancel = cancel
+	b.done = make(chan struct{})
+	grace := b.grace
+	scheduleInterval := b.scheduleInterval
+	done := b.done
+	b.mu.Unlock()
+
+	defer func() {
+		stopParent()
+		cancelHandle()
+		cancel()
+		b.mu.Lock()
+		b.done = nil
+		b.cancel = nil
+		b.mu.Unlock()
+		close(done)
+	}()
+
+	for _, stream := range streams {
+		if b.streamConfig(stream).cursor != nil {
+			continue
+		}
+		if err := b.ensureGroup(stream); err != nil {
+			return fmt.Errorf("failed to create consumer group %s for stream %s: %w", b.group, stream, err)
+		}
 	}
 
-	log.Printf("Starting bus listener for %d streams", len(streams))
+	logger := b.log()
+	logger.Info("Starting bus listener", "streams", len(streams), "group", b.group, "consumer", b.consumer)
+
+	// Subscribed before streams are read, so a request cancelled right after it is picked up is not missed
+	cancellations, err := b.transport.WatchCancellations(b.ctx)
+	if err != nil {
+		logger.Error("Failed to watch request cancellations", LogKeyError, err)
+	}
 
 	for _, stream := range streams {
-		go func(streamName string) {
-			b.processStream(streamName)
-		}(stream)
+		b.wg.Go(func() {
+			b.processStream(stream)
+		})
 	}
+	b.wg.Go(func() {
+		b.runScheduler(scheduleInterval)
+	})
+	b.wg.Go(func() {
+		b.watchCancellations(cancellations)
+	})
+	for _, stream := range streams {
+		b.wg.Go(func() {
+			b.runTrimmer(stream)
+		})
+		if b.streamConfig(stream).cursor == nil {
+			b.wg.Go(func() {
+				b.sampleLag(stream, lagInterval)
+			})
+		}
+	}
+	for _, dlq := range b.deadLetterStreams(streams) {
+		b.wg.Go(func() {
+			b.runTrimmer(dlq)
+		})
+	}
+
+	<-runCtx.Done()
+	logger.Info("Stopping bus, waiting for in-flight messages", "shutdown_timeout", grace)
+
+	drained := make(chan struct{})
+	go func() {
+		b.wg.Wait()
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+	case <-time.After(grace):
+		logger.Warn("Shutdown timeout expired, cancelling in-flight handlers")
+		cancelHandle()
+		<-drained
+	}
+
+	logger.Info("Bus stopped")
+	return nil
 }
 
-// processStream reads messages from Redis stream and processes them
+// processStream reads messages from the stream through the consumer group and processes them
+// Entries are handed to the stream worker pool, reading pauses while all workers are busy
 func (b *Bus) processStream(streamName string) {
-	lastID := "$" // читать только новые сообщения
-	// lastID := "0" // читать все сообщения
+	b.mu.RLock()
+	limiter := b.limiter
+	b.mu.RUnlock()
+
+	cfg := b.streamConfig(streamName)
+	if cfg.cursor != nil {
+		b.processCursorStream(streamName, cfg)
+		return
+	}
+	pool := newWorkerPool(cfg.workers, limiter)
+	defer pool.wait()
+
+	var claimer sync.WaitGroup
+	defer claimer.Wait()
+	claimer.Go(func() {
+		b.claimStale(streamName, pool)
+	})
+	claimer.Go(func() {
+		b.touchRunning(streamName, pool)
+	})
 
 	for {
-		res, err := b.redis.XRead(b.ctx, &redis.XReadArgs{
-			Streams: []string{streamName, lastID},
-			Count:   1,
-			Block:   0, // ждём пока появятся
-		}).Result()
+		reserved := pool.reserve(b.ctx, cfg.readLimit())
+		if reserved == 0 {
+			return
+		}
 
+		entries, err := b.transport.ReadGroup(b.ctx, streamName, b.group, b.consumer, reserved, readBlockTimeout)
 		if err != nil {
-			log.Printf("XRead error: %v", err)
+			pool.release(reserved)
+			if b.ctx.Err() != nil {
+				return
+			}
+			b.log().Error("Failed to read stream", LogKeyStream, streamName, LogKeyError, err)
+			// Back off instead of spinning while Redis is down or the group is missing
+			if !sleepCtx(b.ctx, time.Second) {
+				return
+			}
 			continue
 		}
 
-		// XRead может вернуть массив stream-результатов (обычно 1)
-		for _, stream := range res {
-			for _, msg := range stream.Messages {
-				// Deserialize TransportRequest from message using broker serializer
-				transportReq, err := b.deserializeMessage(msg)
-				if err != nil {
-					log.Printf("failed to deserialize TransportRequest for stream %s, message ID %s: %v", streamName, msg.ID, err)
-					continue
-				}
-				// Create subscriber using factory with properties from TransportRequest
-				b.mu.RLock()
-				factory := b.factory
-				b.mu.RUnlock()
-				subscriber, err := factory.CreateHandler(streamName, transportReq.Properties)
-				if err != nil {
-					log.Printf("failed to create subscriber for stream %s: %v", streamName, err)
-					continue
-				}
-
-				b.processMessage(streamName, subscriber, transportReq)
-			}
+		reserved = b.dispatch(streamName, pool, entries, reserved)
+		pool.release(reserved)
+	}
+}
+
+// dispatch hands read entries to reserved workers and returns the number of unused workers
+func (b *Bus) dispatch(streamName string, pool *workerPool, entries []Entry, reserved int) int {
+	for _, msg := range entries {
+		reserved--
+		pool.run(msg.ID, func() {
+			b.handleEntry(streamName, msg)
+		})
+	}
+	return reserved
+}
 
+// handleEntry processes a single stream entry and acknowledges it in the consumer group
+// The entry stays pending when it could not be stored in the dead-letter stream
+func (b *Bus) handleEntry(streamName string, msg Entry) {
+	// Last resort: a panic outside the handler must not kill the process either
+	defer func() {
+		if v := recover(); v != nil {
+			b.log().Error("Recovered panic while processing message, message left pending",
+				LogKeyStream, streamName, LogKeyRedisMessageID, msg.ID, "panic", v, "stack", string(debug.Stack()))
 		}
+	}()
+
+	if b.processEntry(streamName, msg) {
+		b.ack(streamName, msg.ID)
 	}
 }
 
-// processMessage processes a single message from a stream
-func (b *Bus) processMessage(streamName string, subscriber Subscriber, req *TransportRequest) {
-	result, err := subscriber.Handle(context.Background())
+// processEntry deserializes, handles and answers a single stream entry
+// Returns false when the entry must not be acknowledged
+func (b *Bus) processEntry(streamName string, msg Entry) bool {
+	cfg := b.streamConfig(streamName)
+	policy := cfg.retry
+	metrics := b.metricsSink()
+	logger := b.log().With(LogKeyStream, streamName, LogKeyRedisMessageID, msg.ID)
+	metrics.MessageConsumed(streamName)
+	metrics.InFlight(streamName, 1)
+	defer metrics.InFlight(streamName, -1)
+
+	// Deserialize TransportRequest from message using broker serializer
+	transportReq, err := b.deserializeMessage(msg)
+	if err != nil {
+		logger.Error("Failed to deserialize TransportRequest", LogKeyError, err)
+		return b.deadLetterOrKeep(streamName, msg, policy, FailureDeserialize, 1, err)
+	}
+	transportReq.Stream = streamName
+	logger = logger.With(LogKeyRequestID, transportReq.RequestID)
+	// Set once the response is recorded in the inbox
+	var remembered bool
+	if cfg.inbox != nil {
+		claim, err := b.claimInbox(streamName, cfg.inbox, transportReq)
+		if err != nil {
+			logger.Error("Failed to claim request in inbox, message left pending", LogKeyError, err)
+			return false
+		}
+		switch claim {
+		case inboxProcessed:
+			return true
+		case inboxBusy:
+			// Acknowledged once the other delivery has stored its response, or handled after its claim expires
+			logger.Info("Request is being handled by another delivery, message left pending")
+			return false
+		}
+		// Anything but a recorded response releases the claim, so the next delivery is handled
+		defer func() {
+			if !remembered {
+				b.releaseInbox(streamName, cfg.inbox, transportReq)
+			}
+		}()
+	}
+	handleCtx, span := b.startHandleSpan(ContextWithLogger(b.handleCtx, logger), streamName, transportReq)
+	defer func() { span.End(err) }()
+	if info, err := transportReq.MessageInfo(); err != nil {
+		// Class metadata is advisory, a malformed "m" must not block the message
+		logger.Warn("Failed to decode message info", LogKeyError, err)
+	} else if !info.IsZero() {
+		handleCtx = ContextWithMessageInfo(handleCtx, info)
+	}
+	if transportReq.NeedsResponse() {
+		// Tracked before the check, so a cancellation arriving in between is not missed
+		var untrack func()
+		handleCtx, untrack = b.inflight.track(handleCtx, transportReq.RequestID)
+		defer untrack()
+		if b.requestCancelled(handleCtx, transportReq) {
+			logger.Info("Skipping request cancelled by the caller")
+			err = ErrRequestCancelled
+			return true
+		}
+		if transportReq.StreamResponse {
+			handleCtx = b.contextWithChunkWriter(handleCtx, transportReq)
+		}
+	}
+	// The caller stops waiting after CreatedTimestamp + Timeout, so the handler gets the same deadline
+	if deadline, ok := transportReq.Deadline(); ok && transportReq.NeedsResponse() {
+		if time.Now().After(deadline) {
+			logger.Warn("Skipping expired message")
+			metrics.MessageTimedOut(streamName)
+			b.respond(streamName, transportReq, Response{Error: ErrRequestTimeout})
+			return true
+		}
+		var cancel context.CancelFunc
+		handleCtx, cancel = context.WithDeadline(handleCtx, deadline)
+		defer cancel()
+	}
 
-	if !req.NeedsResponse() {
-		return
+	// Create subscriber using factory with properties from TransportRequest
+	started := time.Now()
+	b.mu.RLock()
+	factory := b.factory
+	b.mu.RUnlock()
+	subscriber, err := createHandler(logger, factory, streamName, transportReq.Properties)
+	if err != nil {
+		logger.Error("Failed to create subscriber", LogKeyError, err)
+		b.observeHandled(streamName, transportReq, started, err)
+		b.respond(streamName, transportReq, Response{Error: err})
+		return b.deadLetterOrKeep(streamName, msg, policy, FailureCreateHandler, 1, err)
 	}
 
-	if result == nil && err == nil {
-		return
+	handler := b.handlerChain(streamName, factory, subscriber)
+	result, attempts, err := b.handleWithRetry(handleCtx, streamName, handler, transportReq, policy)
+	if err != nil && b.handleCtx.Err() != nil {
+		// Cancelled on shutdown: leave pending so another consumer handles it
+		logger.Warn("Handler cancelled on shutdown, message left pending")
+		return false
+	}
+	if err != nil && errors.Is(context.Cause(handleCtx), ErrRequestCancelled) {
+		// The caller is gone, there is nobody to answer and nothing to dead-letter
+		logger.Info("Handler cancelled by the caller")
+		return true
+	}
+	if err != nil && errors.Is(handleCtx.Err(), context.DeadlineExceeded) {
+		// The caller has already given up, there is nothing to dead-letter
+		logger.Warn("Handler exceeded request deadline", LogKeyDuration, time.Since(started))
+		metrics.MessageTimedOut(streamName)
+		b.respond(streamName, transportReq, Response{Error: ErrRequestTimeout})
+		return true
+	}
+	b.observeHandled(streamName, transportReq, started, err)
+	if err == nil && cfg.inbox != nil {
+		remembered = true
+		b.respondAndRemember(streamName, cfg.inbox, transportReq, Response{Data: result})
+		return true
+	}
+	b.respond(streamName, transportReq, Response{Data: result, Error: err})
+	if err != nil && policy.shouldDeadLetter(transportReq, attempts, err) {
+		return b.deadLetterOrKeep(streamName, msg, policy, FailureHandle, attempts, err)
+	}
+	return true
+}
+
+// createHandler calls the factory and converts a constructor panic into a *PanicError
+func createHandler(logger *slog.Logger, factory *HandlerFactory, streamName string, data []byte) (subscriber Subscriber, err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			panicErr := &PanicError{Value: v, Stack: debug.Stack()}
+			logger.Error("Recovered handler constructor panic", "panic", v, "stack", string(panicErr.Stack))
+			subscriber, err = nil, panicErr
+		}
+	}()
+	return factory.CreateHandler(streamName, data)
+}
+
+// deadLetterOrKeep moves the entry to the dead-letter stream and reports whether it can be acknowledged
+func (b *Bus) deadLetterOrKeep(streamName string, msg Entry, policy RetryPolicy, reason string, attempts int, cause error) bool {
+	if err := b.deadLetter(streamName, msg, policy, reason, attempts, cause); err != nil {
+		b.log().Error("Failed to dead-letter message, message left pending",
+			LogKeyStream, streamName, LogKeyRedisMessageID, msg.ID, LogKeyError, err)
+		return false
 	}
+	return true
+}
 
-	response := Response{
-		Data:  result,
-		Error: err,
+// respond sends the handler outcome back to the caller when the request expects it
+func (b *Bus) respond(streamName string, req *TransportRequest, response Response) {
+	if !req.NeedsResponse() {
+		return
 	}
+
+	// An empty response is still sent, otherwise the caller waits until its timeout
 	b.sendResponse(streamName, req.RequestID, req.RedisMessageID, response)
 }
 
-// sendResponse sends a response back via Redis and notifies local waiting calls
+// sendResponse sends a response back via the response list and removes the answered entry
 func (b *Bus) sendResponse(streamName string, requestID string, redisMessageID string, response Response) {
-	const fn = "sendResponse"
+	responseBytes, err := b.encodeResponse(requestID, response)
+	if err != nil {
+		b.log().Error("Failed to encode TransportResponse", LogKeyStream, streamName, LogKeyRequestID, requestID, LogKeyError, err)
+		return
+	}
+	b.pushResponse(streamName, requestID, redisMessageID, responseBytes)
+}
 
+// encodeResponse encodes the handler outcome into a CBOR TransportResponse
+func (b *Bus) encodeResponse(requestID string, response Response) ([]byte, error) {
 	// Create TransportResponse with result data (will be CBOR-encoded by Encode())
 	transportResp := TransportResponse{
 		ReqID:  requestID,
@@ -294,82 +707,46 @@ func (b *Bus) sendResponse(streamName string, requestID string, redisMessageID s
 
 	if response.Error != nil {
 		transportResp.Error = response.Error.Error()
-		transportResp.ErrorClass = fmt.Sprintf("%T", response.Error)
+		registry := b.errorRegistry()
+		transportResp.ErrorClass = registry.Class(response.Error)
+		transportResp.ErrorDetails = registry.Details(response.Error)
 	}
 
 	// Encode TransportResponse to CBOR
-	responseBytes, err := transportResp.Encode()
-	if err != nil {
-		log.Printf("%s: failed to encode TransportResponse for request_id %s: %v", fn, requestID, err)
-		return
-	}
+	return transportResp.Encode()
+}
 
-	// Ответ в Redis
+// pushResponse writes an encoded response to the response list and removes the answered entry
+func (b *Bus) pushResponse(streamName string, requestID string, redisMessageID string, responseBytes []byte) {
+	// Ответ в список с ключом request ID
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	pipe := b.redis.Pipeline()
-	pipe.RPush(ctx, requestID, responseBytes)
-	pipe.Expire(ctx, requestID, 30*time.Second)
-	// Удаляем сообщение из потока
-	pipe.XDel(ctx, streamName, redisMessageID)
-
-	if _, err := pipe.Exec(ctx); err != nil {
-		log.Printf("%s: Failed to write response or delete message: %v", fn, err)
+	if err := b.transport.PushResponse(ctx, requestID, responseBytes, responseTTL); err != nil {
+		b.log().Error("Failed to write response", LogKeyStream, streamName, LogKeyRequestID, requestID, LogKeyError, err)
 	}
 
-	// Also notify local waiting channel if exists
-	b.responseMu.RLock()
-	responseCh, exists := b.responses[requestID]
-	b.responseMu.RUnlock()
-
-	if exists {
-		select {
-		case responseCh <- response:
-			log.Printf("Sent response for request_id: %s", requestID)
-		case <-time.After(5 * time.Second):
-			log.Printf("Timeout sending response for request_id: %s", requestID)
-		}
+	// Удаляем сообщение из потока
+	if err := b.transport.Delete(ctx, streamName, redisMessageID); err != nil {
+		b.log().Error("Failed to delete answered message", LogKeyStream, streamName, LogKeyRedisMessageID, redisMessageID, LogKeyError, err)
 	}
 }
 
-// deserializeMessage deserializes a Redis message to TransportRequest
-// Supports both formats: CBOR-encoded "data" field and individual fields
-func (b *Bus) deserializeMessage(msg redis.XMessage) (*TransportRequest, error) {
-	// Try format 1: CBOR-encoded data in "data" field (legacy Go-to-Go format)
-	if dataRaw, ok := msg.Values["data"]; ok {
-		var data []byte
-		switch v := dataRaw.(type) {
-		case string:
-			data = []byte(v)
-		case []byte:
-			data = v
-		default:
-			return nil, fmt.Errorf("invalid data type: %T", dataRaw)
-		}
-		transportReq, err := DecodeTransportRequest(data)
-		if err != nil {
-			return nil, err
-		}
-		// Set Redis message ID
-		transportReq.RedisMessageID = msg.ID
-		return transportReq, nil
-	}
-
-	// Format 2: Use broker serializer to deserialize from individual fields
-	transportReq, err := b.serializer.Deserialize(msg.Values)
-	if err != nil {
-		return nil, err
-	}
-	// Set Redis message ID
-	transportReq.RedisMessageID = msg.ID
-	return transportReq, nil
+// deserializeMessage deserializes a stream entry to TransportRequest with the bus serializer
+func (b *Bus) deserializeMessage(msg Entry) (*TransportRequest, error) {
+	return decodeEntry(b.serializer, msg)
 }
 
-// Stop stops the bus and all its listeners
+// Stop stops the bus and waits until Run returns
+// It is a no-op when the bus is not running
 func (b *Bus) Stop() {
-	log.Println("Stopping bus...")
-	b.cancel()
-	b.wg.Wait()
-	log.Println("Bus stopped")
+	b.mu.RLock()
+	cancel, done := b.cancel, b.done
+	b.mu.RUnlock()
+
+	if done == nil {
+		return
+	}
+	cancel()
+	<-done
 }
@@ -0,0 +1,91 @@
+package bus_test
+
+import (
+	"context"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/PavelRadostev/toolkit/pkg/bus"
+	"github.com/fxamacker/cbor/v2"
+)
+
+// job is a test message sent to the stream named by Stream
+type job struct {
+	Stream string `cbor:"-"`
+	N      int    `cbor:"n"`
+}
+
+// String returns the stream name of the message
+func (j job) String() string {
+	return j.Stream
+}
+
+// Serialize encodes the message to CBOR
+func (j job) Serialize() ([]byte, error) {
+	return cbor.Marshal(j)
+}
+
+// newBus creates a bus on the transport with a short shutdown timeout and a silent logger
+// A nil factory gives a client-only bus
+func newBus(transport bus.Transport, factory *bus.HandlerFactory) *bus.Bus {
+	b := bus.NewBusWithTransport(transport, context.Background())
+	if factory != nil {
+		b.SetFactory(factory)
+	}
+	b.SetShutdownTimeout(time.Second)
+	b.SetLogger(slog.New(slog.DiscardHandler))
+	return b
+}
+
+// runBus creates the consumer groups of the streams up front, so entries added right away are not missed,
+// and runs the bus until the test ends
+func runBus(t *testing.T, b *bus.Bus, transport bus.Transport, group string, streams ...string) {
+	t.Helper()
+
+	for _, stream := range streams {
+		if err := transport.CreateGroup(context.Background(), stream, group, "$"); err != nil {
+			t.Fatalf("create group %s for %s: %v", group, stream, err)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- b.Run(ctx)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Errorf("run bus: %v", err)
+		}
+	})
+}
+
+// eventually polls cond until it holds or the timeout expires
+func eventually(t *testing.T, timeout time.Duration, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(timeout)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met in time")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// pendingIDs claims every pending entry of the group for a probe consumer and returns their IDs
+func pendingIDs(t *testing.T, transport bus.Transport, stream, group string) []string {
+	t.Helper()
+
+	entries, _, err := transport.Claim(context.Background(), stream, group, "probe", 0, "0-0", 100)
+	if err != nil {
+		t.Fatalf("claim pending entries: %v", err)
+	}
+	ids := make([]string, 0, len(entries))
+	for _, e := range entries {
+		ids = append(ids, e.ID)
+	}
+	return ids
+}
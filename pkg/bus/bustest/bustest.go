@@ -0,0 +1,113 @@
+// Package bustest provides helpers for testing bus handlers and callers without Redis
+package bustest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/PavelRadostev/toolkit/pkg/bus"
+	"github.com/fxamacker/cbor/v2"
+)
+
+// Bus is a running bus on an in-memory transport with a recorder attached
+type Bus struct {
+	*bus.Bus
+	Transport *bus.MemoryTransport
+	Recorder  *Recorder
+}
+
+// NewBus starts a bus on an in-memory transport serving every stream of the factory
+// A nil factory gives a client-only bus. The bus is stopped when the test ends
+func NewBus(t testing.TB, factory *bus.HandlerFactory) *Bus {
+	t.Helper()
+
+	transport := bus.NewMemoryTransport()
+	recorder := NewRecorder()
+
+	b := bus.NewBusWithTransport(transport, context.Background())
+	b.SetShutdownTimeout(time.Second)
+	b.UsePublish(recorder.Middleware())
+
+	tb := &Bus{Bus: b, Transport: transport, Recorder: recorder}
+	if factory == nil {
+		return tb
+	}
+	b.SetFactory(factory)
+
+	streams := factory.GetStreams()
+	if len(streams) == 0 {
+		return tb
+	}
+
+	// Create groups up front, so messages sent right after NewBus are not missed
+	for _, stream := range streams {
+		if err := transport.CreateGroup(context.Background(), stream, bus.DefaultConsumerGroup, "$"); err != nil {
+			t.Fatalf("bustest: create consumer group for %s: %v", stream, err)
+		}
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- b.Run(context.Background())
+	}()
+	t.Cleanup(func() {
+		b.Stop()
+		if err := <-done; err != nil {
+			t.Errorf("bustest: bus run: %v", err)
+		}
+	})
+	return tb
+}
+
+// NewRequest builds a TransportRequest for the stream with the value encoded as CBOR properties
+func NewRequest(t testing.TB, stream string, value any) *bus.TransportRequest {
+	t.Helper()
+
+	properties, err := cbor.Marshal(value)
+	if err != nil {
+		t.Fatalf("bustest: encode %T: %v", value, err)
+	}
+	message, err := bus.EncodeMessageInfo(value)
+	if err != nil {
+		t.Fatalf("bustest: encode message info of %T: %v", value, err)
+	}
+	return &bus.TransportRequest{
+		CreatedTimestamp: float64(time.Now().UnixNano()) / 1e9,
+		RequestID:        "bustest",
+		Stream:           stream,
+		Message:          message,
+		Properties:       properties,
+		ReturnResult:     1,
+		Timeout:          bus.DefaultTimeout,
+	}
+}
+
+// Invoke creates the handler registered for the stream from the value encoded as CBOR
+// properties and calls Handle with the test context
+// The context carries the message class metadata when the value implements bus.Describer
+func Invoke(t testing.TB, factory *bus.HandlerFactory, stream string, value any) (any, error) {
+	t.Helper()
+
+	req := NewRequest(t, stream, value)
+	subscriber, err := factory.CreateHandler(stream, req.Properties)
+	if err != nil {
+		t.Fatalf("bustest: create handler for %s: %v", stream, err)
+	}
+	ctx := t.Context()
+	if describer, ok := value.(bus.Describer); ok {
+		ctx = bus.ContextWithMessageInfo(ctx, describer.MessageInfo())
+	}
+	return subscriber.Handle(ctx)
+}
+
+// Decode decodes the properties of a recorded request into T
+func Decode[T any](t testing.TB, req *bus.TransportRequest) T {
+	t.Helper()
+
+	var value T
+	if err := req.DecodeProperties(&value); err != nil {
+		t.Fatalf("bustest: decode properties of %s into %T: %v", req.Stream, value, err)
+	}
+	return value
+}
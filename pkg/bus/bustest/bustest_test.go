@@ -0,0 +1,63 @@
+package bustest_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/PavelRadostev/toolkit/pkg/bus"
+	"github.com/PavelRadostev/toolkit/pkg/bus/bustest"
+)
+
+type increment struct {
+	N int `cbor:"n"`
+}
+
+func (increment) String() string { return "increment" }
+
+type lookup struct {
+	ID int `cbor:"id"`
+}
+
+func (lookup) String() string { return "lookup" }
+
+func newFactory() *bus.HandlerFactory {
+	factory := bus.NewHandlerFactory()
+	bus.Handle(factory, "increment", func(ctx context.Context, q increment) (int, error) {
+		return q.N + 1, nil
+	})
+	return factory
+}
+
+func TestInvoke(t *testing.T) {
+	result, err := bustest.Invoke(t, newFactory(), "increment", increment{N: 1})
+	if err != nil || result != 2 {
+		t.Fatalf("invoke: got %v (%v), want 2", result, err)
+	}
+}
+
+func TestNewBusServesFactoryStreams(t *testing.T) {
+	b := bustest.NewBus(t, newFactory())
+
+	got, err := bus.Call[increment, int](t.Context(), b.Bus, increment{N: 5})
+	if err != nil || got != 6 {
+		t.Fatalf("call: got %d (%v), want 6", got, err)
+	}
+	bustest.AssertEmitted(t, b.Recorder, "increment", 1)
+}
+
+func TestRecorderStubsStreamsWithoutHandlers(t *testing.T) {
+	b := bustest.NewBus(t, nil)
+	b.Recorder.Stub("lookup", bus.Response{Data: 7})
+
+	got, err := bus.Call[lookup, int](t.Context(), b.Bus, lookup{ID: 5})
+	if err != nil || got != 7 {
+		t.Fatalf("call: got %d (%v), want the stubbed 7", got, err)
+	}
+	sent := bustest.Emitted[lookup](t, b.Recorder, "lookup")
+	if len(sent) != 1 || sent[0].ID != 5 {
+		t.Fatalf("recorded messages: got %v", sent)
+	}
+
+	b.Recorder.Reset()
+	bustest.AssertEmitted(t, b.Recorder, "lookup", 0)
+}
@@ -0,0 +1,94 @@
+package bustest
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/PavelRadostev/toolkit/pkg/bus"
+)
+
+// Recorder captures messages published through a bus and serves canned responses
+type Recorder struct {
+	mu       sync.RWMutex
+	messages map[string][]*bus.TransportRequest
+	stubs    map[string]func(req *bus.TransportRequest) bus.Response
+}
+
+// NewRecorder creates an empty recorder
+func NewRecorder() *Recorder {
+	return &Recorder{
+		messages: make(map[string][]*bus.TransportRequest),
+		stubs:    make(map[string]func(req *bus.TransportRequest) bus.Response),
+	}
+}
+
+// Middleware records every Execute and Emit call
+// Calls to stubbed streams return the canned response and never reach the transport
+func (r *Recorder) Middleware() bus.PublishMiddleware {
+	return func(next bus.PublishFunc) bus.PublishFunc {
+		return func(ctx context.Context, streamName string, req *bus.TransportRequest) (bus.Response, error) {
+			recorded := *req
+			recorded.Stream = streamName
+
+			r.mu.Lock()
+			r.messages[streamName] = append(r.messages[streamName], &recorded)
+			stub, ok := r.stubs[streamName]
+			r.mu.Unlock()
+
+			if ok {
+				return stub(&recorded), nil
+			}
+			return next(ctx, streamName, req)
+		}
+	}
+}
+
+// Stub makes Execute calls to the stream return the response without sending anything
+func (r *Recorder) Stub(stream string, resp bus.Response) {
+	r.StubFunc(stream, func(*bus.TransportRequest) bus.Response {
+		return resp
+	})
+}
+
+// StubFunc makes Execute calls to the stream return the response built by fn
+func (r *Recorder) StubFunc(stream string, fn func(req *bus.TransportRequest) bus.Response) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.stubs[stream] = fn
+}
+
+// Messages returns the requests published to the stream in order
+func (r *Recorder) Messages(stream string) []*bus.TransportRequest {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return append([]*bus.TransportRequest(nil), r.messages[stream]...)
+}
+
+// Reset forgets every recorded message, stubs are kept
+func (r *Recorder) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.messages = make(map[string][]*bus.TransportRequest)
+}
+
+// AssertEmitted fails the test unless exactly n messages were published to the stream
+func AssertEmitted(t testing.TB, r *Recorder, stream string, n int) {
+	t.Helper()
+
+	if got := len(r.Messages(stream)); got != n {
+		t.Errorf("bustest: expected %d messages in stream %s, got %d", n, stream, got)
+	}
+}
+
+// Emitted decodes the properties of every message published to the stream into T
+func Emitted[T any](t testing.TB, r *Recorder, stream string) []T {
+	t.Helper()
+
+	messages := r.Messages(stream)
+	values := make([]T, 0, len(messages))
+	for _, req := range messages {
+		values = append(values, Decode[T](t, req))
+	}
+	return values
+}
@@ -0,0 +1,271 @@
+package bustest
+
+import (
+	"embed"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"maps"
+	"path"
+	"reflect"
+	"testing"
+
+	"github.com/PavelRadostev/toolkit/pkg/bus"
+	"github.com/fxamacker/cbor/v2"
+)
+
+//go:embed fixtures/*.json
+var fixtureFS embed.FS
+
+// Fixture kinds
+const (
+	FixtureRequest  = "request"
+	FixtureResponse = "response"
+)
+
+// WireFixture is a stream entry or response in the layout documented in bus.ProtocolVersion
+// The corpus is hand-written and encoded with the Go CBOR library: it pins the documented format
+// against regressions on the Go side, it is not captured from the Python library
+type WireFixture struct {
+	Name            string `json:"name"`
+	Description     string `json:"description"`
+	ProtocolVersion int    `json:"protocol_version"`
+	Kind            string `json:"kind"`
+	// DecodeOnly skips the re-serialization check for entries that do not round-trip
+	DecodeOnly bool `json:"decode_only"`
+
+	// Entry holds string values of a request entry as is
+	Entry map[string]string `json:"entry"`
+	// EntryCBOR holds binary values of a request entry, hex-encoded
+	EntryCBOR map[string]string `json:"entry_cbor"`
+	// Response holds a CBOR-encoded response, hex-encoded
+	Response string `json:"response"`
+
+	Expected WireExpectation `json:"expected"`
+}
+
+// WireExpectation holds the decoded values expected for a fixture, binary values hex-encoded
+type WireExpectation struct {
+	// Request
+	RequestID        string  `json:"request_id"`
+	ReturnResult     int     `json:"return_result"`
+	Timeout          int     `json:"timeout"`
+	CreatedTimestamp float64 `json:"created_timestamp"`
+	Properties       string  `json:"properties"`
+	Message          string  `json:"message"`
+	TraceContext     string  `json:"trace_context"`
+	StreamResponse   bool    `json:"stream_response"`
+	// MessageInfo is the decoded "m" value, checked when set
+	MessageInfo *bus.MessageInfo `json:"message_info"`
+	// TraceCarrier is the decoded "h" value, checked when set
+	TraceCarrier bus.TraceCarrier `json:"trace_carrier"`
+
+	// Response
+	ReqID      string `json:"req_id"`
+	Result     string `json:"result"`
+	Error      string `json:"error"`
+	ErrorClass string `json:"error_class"`
+	More       bool   `json:"more"`
+}
+
+// WireFixtures returns the embedded fixture corpus sorted by file name
+func WireFixtures() ([]WireFixture, error) {
+	names, err := fs.Glob(fixtureFS, "fixtures/*.json")
+	if err != nil {
+		return nil, err
+	}
+
+	fixtures := make([]WireFixture, 0, len(names))
+	for _, name := range names {
+		data, err := fixtureFS.ReadFile(name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read fixture %s: %w", name, err)
+		}
+		var fixture WireFixture
+		if err := json.Unmarshal(data, &fixture); err != nil {
+			return nil, fmt.Errorf("failed to parse fixture %s: %w", name, err)
+		}
+		if fixture.Name == "" {
+			fixture.Name = path.Base(name)
+		}
+		fixtures = append(fixtures, fixture)
+	}
+	return fixtures, nil
+}
+
+// StreamEntry builds the stream entry of a request fixture
+func (f WireFixture) StreamEntry() (bus.Entry, error) {
+	values := make(map[string]interface{}, len(f.Entry)+len(f.EntryCBOR))
+	for field, value := range f.Entry {
+		values[field] = value
+	}
+	for field, value := range f.EntryCBOR {
+		data, err := hex.DecodeString(value)
+		if err != nil {
+			return bus.Entry{}, fmt.Errorf("invalid hex in field %q: %w", field, err)
+		}
+		// Redis returns every value as a string
+		values[field] = string(data)
+	}
+	return bus.Entry{ID: "1714214741926-0", Values: values}, nil
+}
+
+// CheckWireFixtures runs every fixture of the corpus as a subtest
+// Requests are decoded with bus.DecodeEntry and serialized back, responses are decoded and encoded back
+func CheckWireFixtures(t *testing.T) {
+	t.Helper()
+
+	fixtures, err := WireFixtures()
+	if err != nil {
+		t.Fatalf("bustest: load wire fixtures: %v", err)
+	}
+	for _, fixture := range fixtures {
+		t.Run(fixture.Name, func(t *testing.T) {
+			if fixture.ProtocolVersion > bus.ProtocolVersion {
+				t.Fatalf("fixture protocol version %d is newer than supported %d", fixture.ProtocolVersion, bus.ProtocolVersion)
+			}
+			switch fixture.Kind {
+			case FixtureRequest:
+				checkRequestFixture(t, fixture)
+			case FixtureResponse:
+				checkResponseFixture(t, fixture)
+			default:
+				t.Fatalf("unknown fixture kind %q", fixture.Kind)
+			}
+		})
+	}
+}
+
+// checkRequestFixture decodes a request entry and serializes it back
+func checkRequestFixture(t *testing.T, fixture WireFixture) {
+	t.Helper()
+
+	entry, err := fixture.StreamEntry()
+	if err != nil {
+		t.Fatalf("build entry: %v", err)
+	}
+	req, err := bus.DecodeEntry(entry)
+	if err != nil {
+		t.Fatalf("decode entry: %v", err)
+	}
+
+	want := fixture.Expected
+	if req.RedisMessageID != entry.ID {
+		t.Errorf("message ID: got %q, want %q", req.RedisMessageID, entry.ID)
+	}
+	if req.RequestID != want.RequestID {
+		t.Errorf("request ID: got %q, want %q", req.RequestID, want.RequestID)
+	}
+	if req.ReturnResult != want.ReturnResult {
+		t.Errorf("return result: got %d, want %d", req.ReturnResult, want.ReturnResult)
+	}
+	if req.Timeout != want.Timeout {
+		t.Errorf("timeout: got %d, want %d", req.Timeout, want.Timeout)
+	}
+	if req.CreatedTimestamp != want.CreatedTimestamp {
+		t.Errorf("created timestamp: got %v, want %v", req.CreatedTimestamp, want.CreatedTimestamp)
+	}
+	if got := hex.EncodeToString(req.Properties); got != want.Properties {
+		t.Errorf("properties: got %s, want %s", got, want.Properties)
+	}
+	if got := hex.EncodeToString(req.Message); got != want.Message {
+		t.Errorf("message: got %s, want %s", got, want.Message)
+	}
+	if want.MessageInfo != nil {
+		info, err := req.MessageInfo()
+		if err != nil {
+			t.Errorf("decode message info: %v", err)
+		} else if info != *want.MessageInfo {
+			t.Errorf("message info: got %+v, want %+v", info, *want.MessageInfo)
+		}
+	}
+
+	if got := hex.EncodeToString(req.TraceContext); got != want.TraceContext {
+		t.Errorf("trace context: got %s, want %s", got, want.TraceContext)
+	}
+	if want.TraceCarrier != nil {
+		carrier, err := req.TraceCarrier()
+		if err != nil {
+			t.Errorf("decode trace context: %v", err)
+		} else if !maps.Equal(carrier, want.TraceCarrier) {
+			t.Errorf("trace carrier: got %v, want %v", carrier, want.TraceCarrier)
+		}
+	}
+
+	if req.StreamResponse != want.StreamResponse {
+		t.Errorf("stream response: got %t, want %t", req.StreamResponse, want.StreamResponse)
+	}
+
+	if fixture.DecodeOnly {
+		return
+	}
+	values, err := bus.NewRedisBrokerSerialize().Serialize(req)
+	if err != nil {
+		t.Fatalf("serialize: %v", err)
+	}
+	if !reflect.DeepEqual(values, entry.Values) {
+		t.Errorf("serialized entry differs:\n got  %q\n want %q", values, entry.Values)
+	}
+}
+
+// checkResponseFixture decodes a response and checks it survives an encode round trip
+func checkResponseFixture(t *testing.T, fixture WireFixture) {
+	t.Helper()
+
+	data, err := hex.DecodeString(fixture.Response)
+	if err != nil {
+		t.Fatalf("invalid response hex: %v", err)
+	}
+	resp, err := bus.DecodeTransportResponse(data)
+	if err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	checkResponse(t, resp, fixture.Expected)
+
+	encoded, err := resp.Encode()
+	if err != nil {
+		t.Fatalf("encode response: %v", err)
+	}
+	again, err := bus.DecodeTransportResponse(encoded)
+	if err != nil {
+		t.Fatalf("decode re-encoded response: %v", err)
+	}
+	checkResponse(t, again, fixture.Expected)
+}
+
+// checkResponse compares a decoded response with the expectation
+func checkResponse(t *testing.T, resp *bus.TransportResponse, want WireExpectation) {
+	t.Helper()
+
+	if resp.ReqID != want.ReqID {
+		t.Errorf("req_id: got %q, want %q", resp.ReqID, want.ReqID)
+	}
+	if resp.Error != want.Error {
+		t.Errorf("error: got %q, want %q", resp.Error, want.Error)
+	}
+	if resp.ErrorClass != want.ErrorClass {
+		t.Errorf("error_class: got %q, want %q", resp.ErrorClass, want.ErrorClass)
+	}
+	if resp.More != want.More {
+		t.Errorf("more: got %t, want %t", resp.More, want.More)
+	}
+
+	var expected any
+	if want.Result != "" {
+		raw, err := hex.DecodeString(want.Result)
+		if err != nil {
+			t.Fatalf("invalid result hex: %v", err)
+		}
+		if err := cbor.Unmarshal(raw, &expected); err != nil {
+			t.Fatalf("decode expected result: %v", err)
+		}
+	}
+	var got any
+	if err := resp.Response().Decode(&got); err != nil {
+		t.Fatalf("decode result: %v", err)
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("result: got %#v, want %#v", got, expected)
+	}
+}
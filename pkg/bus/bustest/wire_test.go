@@ -0,0 +1,11 @@
+package bustest_test
+
+import (
+	"testing"
+
+	"github.com/PavelRadostev/toolkit/pkg/bus/bustest"
+)
+
+func TestWireFixtures(t *testing.T) {
+	bustest.CheckWireFixtures(t)
+}
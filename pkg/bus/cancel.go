@@ -0,0 +1,119 @@
+package bus
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrRequestCancelled is the cause of a handler context cancelled because the caller stopped waiting
+var ErrRequestCancelled = errors.New("request cancelled by caller")
+
+// inflightRequest is a request being handled that the caller may cancel
+type inflightRequest struct {
+	cancel context.CancelCauseFunc
+}
+
+// inflightRequests tracks handled requests by request ID
+type inflightRequests struct {
+	mu       sync.Mutex
+	requests map[string]*inflightRequest
+}
+
+// track returns a context cancelled when the request is cancelled and a function to stop tracking it
+func (r *inflightRequests) track(ctx context.Context, requestID string) (context.Context, func()) {
+	ctx, cancel := context.WithCancelCause(ctx)
+	req := &inflightRequest{cancel: cancel}
+
+	r.mu.Lock()
+	if r.requests == nil {
+		r.requests = make(map[string]*inflightRequest)
+	}
+	r.requests[requestID] = req
+	r.mu.Unlock()
+
+	return ctx, func() {
+		r.mu.Lock()
+		if r.requests[requestID] == req {
+			delete(r.requests, requestID)
+		}
+		r.mu.Unlock()
+		cancel(nil)
+	}
+}
+
+// cancel cancels the handler context of the request, reports false when it is not handled here
+func (r *inflightRequests) cancel(requestID string) bool {
+	r.mu.Lock()
+	req, ok := r.requests[requestID]
+	r.mu.Unlock()
+	if ok {
+		req.cancel(ErrRequestCancelled)
+	}
+	return ok
+}
+
+// cancelRequest tells consumers that the caller of Execute stopped waiting for the request
+// The marker lives until the request deadline, after which the handler gives up anyway
+func (b *Bus) cancelRequest(ctx context.Context, streamName string, req *TransportRequest) {
+	ttl := time.Second
+	if deadline, ok := req.Deadline(); ok {
+		ttl = max(time.Until(deadline), ttl)
+	}
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+	defer cancel()
+	if err := b.transport.CancelRequest(ctx, req.RequestID, ttl); err != nil {
+		b.log().Error("Failed to cancel request", LogKeyStream, streamName, LogKeyRequestID, req.RequestID, LogKeyError, err)
+		return
+	}
+	b.log().Debug("Cancelled request", LogKeyStream, streamName, LogKeyRequestID, req.RequestID)
+}
+
+// requestCancelled reports whether the caller cancelled the request before it was handled
+// A failed check is logged and the request is handled
+func (b *Bus) requestCancelled(ctx context.Context, req *TransportRequest) bool {
+	cancelled, err := b.transport.RequestCancelled(ctx, req.RequestID)
+	if err != nil {
+		LoggerFromContext(ctx).Warn("Failed to check request cancellation", LogKeyError, err)
+		return false
+	}
+	return cancelled
+}
+
+// watchCancellations cancels handlers of requests whose callers stopped waiting, until the bus stops
+// ids is the subscription made by Run, nil when it failed; a lost subscription is renewed
+func (b *Bus) watchCancellations(ids <-chan string) {
+	for b.ctx.Err() == nil {
+		if ids == nil {
+			var err error
+			if ids, err = b.transport.WatchCancellations(b.ctx); err != nil {
+				if b.ctx.Err() == nil {
+					b.log().Error("Failed to watch request cancellations", LogKeyError, err)
+					sleepCtx(b.ctx, time.Second)
+				}
+				continue
+			}
+		}
+		b.cancelInflight(ids)
+		ids = nil
+	}
+}
+
+// cancelInflight cancels the handlers of received request IDs until the subscription ends or the bus stops
+func (b *Bus) cancelInflight(ids <-chan string) {
+	for {
+		select {
+		case <-b.ctx.Done():
+			return
+		case id, ok := <-ids:
+			if !ok {
+				return
+			}
+			if b.inflight.cancel(id) {
+				b.log().Info("Cancelling handler, the caller stopped waiting", LogKeyRequestID, id)
+			}
+		}
+	}
+}
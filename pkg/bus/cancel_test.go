@@ -0,0 +1,113 @@
+package bus_test
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/PavelRadostev/toolkit/pkg/bus"
+)
+
+// recordRequestIDs stores the ID of every request the bus sends into id
+func recordRequestIDs(b *bus.Bus, id *atomic.Value) {
+	b.UsePublish(func(next bus.PublishFunc) bus.PublishFunc {
+		return func(ctx context.Context, streamName string, req *bus.TransportRequest) (bus.Response, error) {
+			id.Store(req.RequestID)
+			return next(ctx, streamName, req)
+		}
+	})
+}
+
+// noResponse fails the test when a response to the request was pushed
+func noResponse(t *testing.T, transport bus.Transport, requestID string) {
+	t.Helper()
+
+	if data, err := transport.PopResponse(t.Context(), requestID, 20*time.Millisecond); err != nil || data != nil {
+		t.Fatalf("response to a cancelled request: got %q (%v), want none", data, err)
+	}
+}
+
+func TestCancelledRequestIsSkippedBeforePickup(t *testing.T) {
+	transport := bus.NewMemoryTransport()
+	var calls atomic.Int32
+	factory := bus.NewHandlerFactory()
+	bus.Handle(factory, "jobs", func(ctx context.Context, j job) (int, error) {
+		calls.Add(1)
+		return 1, nil
+	})
+	if err := transport.CreateGroup(t.Context(), "jobs", bus.DefaultConsumerGroup, "$"); err != nil {
+		t.Fatalf("create group: %v", err)
+	}
+
+	// The caller gives up while no consumer is running
+	caller := newBus(transport, nil)
+	var requestID atomic.Value
+	recordRequestIDs(caller, &requestID)
+	ctx, cancel := context.WithTimeout(t.Context(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := caller.Execute(ctx, job{Stream: "jobs", N: 1}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("execute: got %v, want the context error", err)
+	}
+
+	b := newBus(transport, factory)
+	b.Register("jobs")
+	runBus(t, b, transport, bus.DefaultConsumerGroup, "jobs")
+
+	eventually(t, time.Second, func() bool {
+		lag, err := transport.GroupLag(context.Background(), "jobs", bus.DefaultConsumerGroup)
+		return err == nil && lag == 0 && len(pendingIDs(t, transport, "jobs", bus.DefaultConsumerGroup)) == 0
+	})
+	if got := calls.Load(); got != 0 {
+		t.Fatalf("handler calls: got %d, want the cancelled request skipped", got)
+	}
+	noResponse(t, transport, requestID.Load().(string))
+}
+
+func TestCancelledRequestStopsRunningHandler(t *testing.T) {
+	transport := bus.NewMemoryTransport()
+	started := make(chan struct{})
+	causes := make(chan error, 1)
+	factory := bus.NewHandlerFactory()
+	bus.Handle(factory, "jobs", func(ctx context.Context, j job) (int, error) {
+		close(started)
+		<-ctx.Done()
+		causes <- context.Cause(ctx)
+		return 0, ctx.Err()
+	})
+
+	b := newBus(transport, factory)
+	b.Register("jobs")
+	runBus(t, b, transport, bus.DefaultConsumerGroup, "jobs")
+
+	caller := newBus(transport, nil)
+	var requestID atomic.Value
+	recordRequestIDs(caller, &requestID)
+	ctx, cancel := context.WithCancel(t.Context())
+	go func() {
+		<-started
+		cancel()
+	}()
+	if _, err := caller.Execute(ctx, job{Stream: "jobs", N: 1}, bus.WithTimeout(time.Minute)); !errors.Is(err, context.Canceled) {
+		t.Fatalf("execute: got %v, want the context error", err)
+	}
+
+	select {
+	case cause := <-causes:
+		if !errors.Is(cause, bus.ErrRequestCancelled) {
+			t.Fatalf("handler context cause: got %v, want ErrRequestCancelled", cause)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("handler not cancelled")
+	}
+
+	// The request is acknowledged without a response or a dead letter
+	eventually(t, time.Second, func() bool {
+		return len(pendingIDs(t, transport, "jobs", bus.DefaultConsumerGroup)) == 0
+	})
+	noResponse(t, transport, requestID.Load().(string))
+	if entries, err := transport.Read(t.Context(), "jobs.dlq", "0-0", 10, 0); err != nil || len(entries) != 0 {
+		t.Fatalf("dead letters: got %v (%v), want none", entries, err)
+	}
+}
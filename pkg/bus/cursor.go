@@ -0,0 +1,239 @@
+package bus
+
+import (
+	"context"
+	"errors"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// cursorKeyPrefix prefixes Redis keys of stored cursors
+const cursorKeyPrefix = "bus:cursor:"
+
+// StartPosition is where consumption of a stream starts when there is no stored position yet
+// The zero value starts with new entries only
+type StartPosition struct {
+	// id is the entry ID after which entries are delivered, "$" means the current end of the stream
+	id string
+}
+
+// StartLatest starts with entries added after the consumer starts
+func StartLatest() StartPosition {
+	return StartPosition{id: "$"}
+}
+
+// StartEarliest starts with the oldest entry still in the stream
+func StartEarliest() StartPosition {
+	return StartPosition{id: "0-0"}
+}
+
+// StartAfterID starts with the first entry after the given entry ID
+func StartAfterID(id string) StartPosition {
+	return StartPosition{id: id}
+}
+
+// StartAtTime starts with the first entry added at or after t
+func StartAtTime(t time.Time) StartPosition {
+	ms := t.UnixMilli()
+	if ms <= 0 {
+		return StartEarliest()
+	}
+	// The greatest ID of the previous millisecond, so entries of ms itself are delivered
+	return StartPosition{id: strconv.FormatInt(ms-1, 10) + "-" + strconv.FormatUint(math.MaxUint64, 10)}
+}
+
+// latest reports whether the position is the current end of the stream
+func (p StartPosition) latest() bool {
+	return p.id == "" || p.id == "$"
+}
+
+// groupStart returns the start ID for XGROUP CREATE
+func (p StartPosition) groupStart() string {
+	if p.latest() {
+		return "$"
+	}
+	return p.id
+}
+
+// WithStartPosition sets where a new consumer group, or a cursor without a stored position, starts
+// An existing consumer group keeps its own position
+func WithStartPosition(pos StartPosition) StreamOption {
+	return func(c *streamConfig) {
+		c.start = pos
+	}
+}
+
+// CursorStore persists the last processed entry ID of a stream read without a consumer group
+type CursorStore interface {
+	// Load returns the stored entry ID, found is false when nothing is stored yet
+	Load(ctx context.Context, name, stream string) (id string, found bool, err error)
+	// Save stores the entry ID
+	Save(ctx context.Context, name, stream, id string) error
+}
+
+// WithCursor reads the stream without a consumer group, from a cursor persisted under name
+// Every instance with the cursor sees every entry, in order, one at a time; a restart resumes after
+// the last processed entry. Use it for projections that must see every event
+// The name must stay the same across restarts, entries are not acknowledged or reclaimed
+func WithCursor(name string, store CursorStore) StreamOption {
+	return func(c *streamConfig) {
+		c.cursorName = name
+		c.cursor = store
+	}
+}
+
+// RedisCursorClient defines the Redis operations used by RedisCursorStore
+type RedisCursorClient interface {
+	Get(ctx context.Context, key string) *redis.StringCmd
+	Set(ctx context.Context, key string, value interface{}, expiration time.Duration) *redis.StatusCmd
+}
+
+// RedisCursorStore implements CursorStore with Redis keys without expiry
+type RedisCursorStore struct {
+	client RedisCursorClient
+}
+
+// NewRedisCursorStore creates a CursorStore backed by Redis
+func NewRedisCursorStore(client RedisCursorClient) *RedisCursorStore {
+	return &RedisCursorStore{client: client}
+}
+
+// Load implements CursorStore
+func (s *RedisCursorStore) Load(ctx context.Context, name, stream string) (string, bool, error) {
+	id, err := s.client.Get(ctx, cursorKey(name, stream)).Result()
+	if errors.Is(err, redis.Nil) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	return id, true, nil
+}
+
+// Save implements CursorStore
+func (s *RedisCursorStore) Save(ctx context.Context, name, stream, id string) error {
+	return s.client.Set(ctx, cursorKey(name, stream), id, 0).Err()
+}
+
+// cursorKey builds the Redis key of a stored cursor
+func cursorKey(name, stream string) string {
+	return cursorKeyPrefix + name + ":" + stream
+}
+
+// MemoryCursorStore implements CursorStore in process memory, for tests and local development
+type MemoryCursorStore struct {
+	mu      sync.Mutex
+	cursors map[string]string
+}
+
+// NewMemoryCursorStore creates an empty in-memory CursorStore
+func NewMemoryCursorStore() *MemoryCursorStore {
+	return &MemoryCursorStore{cursors: make(map[string]string)}
+}
+
+// Load implements CursorStore
+func (s *MemoryCursorStore) Load(_ context.Context, name, stream string) (string, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id, ok := s.cursors[cursorKey(name, stream)]
+	return id, ok, nil
+}
+
+// Save implements CursorStore
+func (s *MemoryCursorStore) Save(_ context.Context, name, stream, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cursors[cursorKey(name, stream)] = id
+	return nil
+}
+
+// loadCursor returns the stored cursor of the stream, resolving the start position when nothing is stored
+// A resolved "latest" position is saved right away, so messages added while the consumer is down are not skipped
+func (b *Bus) loadCursor(streamName string, cfg streamConfig) (string, error) {
+	id, found, err := cfg.cursor.Load(b.ctx, cfg.cursorName, streamName)
+	if err != nil || found {
+		return id, err
+	}
+
+	if !cfg.start.latest() {
+		return cfg.start.id, nil
+	}
+	if id, err = b.transport.LastID(b.ctx, streamName); err != nil {
+		return "", err
+	}
+	return id, cfg.cursor.Save(b.ctx, cfg.cursorName, streamName, id)
+}
+
+// processCursorStream reads the stream without a consumer group and handles entries one by one,
+// saving the cursor after each of them
+func (b *Bus) processCursorStream(streamName string, cfg streamConfig) {
+	cursor, err := b.loadCursor(streamName, cfg)
+	for err != nil {
+		if b.ctx.Err() != nil {
+			return
+		}
+		b.log().Error("Failed to load cursor", LogKeyStream, streamName, "cursor", cfg.cursorName, LogKeyError, err)
+		if !sleepCtx(b.ctx, time.Second) {
+			return
+		}
+		cursor, err = b.loadCursor(streamName, cfg)
+	}
+	b.log().Info("Reading stream with cursor", LogKeyStream, streamName, "cursor", cfg.cursorName, "from", cursor)
+
+	for {
+		entries, err := b.transport.Read(b.ctx, streamName, cursor, cfg.readLimit(), readBlockTimeout)
+		if err != nil {
+			if b.ctx.Err() != nil {
+				return
+			}
+			b.log().Error("Failed to read stream", LogKeyStream, streamName, LogKeyError, err)
+			if !sleepCtx(b.ctx, time.Second) {
+				return
+			}
+			continue
+		}
+
+		for _, msg := range entries {
+			if !b.handleCursorEntry(streamName, msg) {
+				// Not processed: read it again after a pause instead of skipping it
+				if !sleepCtx(b.ctx, time.Second) {
+					return
+				}
+				break
+			}
+			cursor = msg.ID
+			if err := cfg.cursor.Save(context.WithoutCancel(b.ctx), cfg.cursorName, streamName, cursor); err != nil {
+				b.log().Error("Failed to save cursor", LogKeyStream, streamName, "cursor", cfg.cursorName, LogKeyRedisMessageID, cursor, LogKeyError, err)
+			}
+		}
+	}
+}
+
+// handleCursorEntry processes a single entry read without a consumer group
+// Returns false when the entry must be processed again
+func (b *Bus) handleCursorEntry(streamName string, msg Entry) (processed bool) {
+	defer func() {
+		if v := recover(); v != nil {
+			b.log().Error("Recovered panic while processing message, cursor not advanced",
+				LogKeyStream, streamName, LogKeyRedisMessageID, msg.ID, "panic", v)
+			processed = false
+		}
+	}()
+	return b.processEntry(streamName, msg)
+}
+
+// sleepCtx waits for d or until ctx is done, returns false when ctx is done
+func sleepCtx(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
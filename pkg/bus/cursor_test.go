@@ -0,0 +1,108 @@
+package bus_test
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/PavelRadostev/toolkit/pkg/bus"
+)
+
+// cursorConsumer runs a bus reading "plans" with the stored cursor and records the handled events
+type cursorConsumer struct {
+	mu   sync.Mutex
+	seen []int
+}
+
+func (c *cursorConsumer) handled() []int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return slices.Clone(c.seen)
+}
+
+// start runs a bus with the cursor until stop is called
+func (c *cursorConsumer) start(transport bus.Transport, store bus.CursorStore, pos bus.StartPosition) (stop func()) {
+	factory := bus.NewHandlerFactory()
+	bus.HandleEvent(factory, "plans", func(ctx context.Context, j job) error {
+		c.mu.Lock()
+		c.seen = append(c.seen, j.N)
+		c.mu.Unlock()
+		return nil
+	})
+	b := newBus(transport, factory)
+	b.Register("plans", bus.WithCursor("projection", store), bus.WithStartPosition(pos))
+
+	done := make(chan error, 1)
+	go func() { done <- b.Run(context.Background()) }()
+	return func() {
+		b.Stop()
+		<-done
+	}
+}
+
+func TestCursorResumesAfterDowntime(t *testing.T) {
+	transport := bus.NewMemoryTransport()
+	store := bus.NewMemoryCursorStore()
+	sender := newBus(transport, nil)
+	emit := func(n int) {
+		t.Helper()
+		if err := sender.Emit(t.Context(), job{Stream: "plans", N: n}); err != nil {
+			t.Fatalf("emit: %v", err)
+		}
+	}
+
+	var consumer cursorConsumer
+	// Sent before the first start, delivered because the consumer starts from the earliest entry
+	emit(1)
+	stop := consumer.start(transport, store, bus.StartEarliest())
+	emit(2)
+	eventually(t, time.Second, func() bool { return len(consumer.handled()) == 2 })
+	stop()
+
+	// Sent while the consumer is down
+	emit(3)
+	stop = consumer.start(transport, store, bus.StartEarliest())
+	defer stop()
+	eventually(t, time.Second, func() bool { return len(consumer.handled()) == 3 })
+
+	if got := consumer.handled(); !slices.Equal(got, []int{1, 2, 3}) {
+		t.Fatalf("handled: got %v, want every event once in order", got)
+	}
+	last, _ := transport.LastID(t.Context(), "plans")
+	if id, found, err := store.Load(t.Context(), "projection", "plans"); err != nil || !found || id != last {
+		t.Fatalf("stored cursor: got %q %v (%v), want %s", id, found, err, last)
+	}
+}
+
+func TestCursorStartsAtLatest(t *testing.T) {
+	transport := bus.NewMemoryTransport()
+	store := bus.NewMemoryCursorStore()
+	sender := newBus(transport, nil)
+	if err := sender.Emit(t.Context(), job{Stream: "plans", N: 1}); err != nil {
+		t.Fatalf("emit: %v", err)
+	}
+
+	var consumer cursorConsumer
+	stop := consumer.start(transport, store, bus.StartLatest())
+	defer stop()
+	// The latest position is stored on start, later events are delivered
+	eventually(t, time.Second, func() bool {
+		_, found, _ := store.Load(t.Context(), "projection", "plans")
+		return found
+	})
+	if err := sender.Emit(t.Context(), job{Stream: "plans", N: 2}); err != nil {
+		t.Fatalf("emit: %v", err)
+	}
+	eventually(t, time.Second, func() bool { return len(consumer.handled()) == 1 })
+	if got := consumer.handled(); got[0] != 2 {
+		t.Fatalf("handled: got %v, want only the event sent after start", got)
+	}
+}
+
+func TestStartAtTime(t *testing.T) {
+	if got, want := bus.StartAtTime(time.UnixMilli(1000)), bus.StartAfterID("999-18446744073709551615"); got != want {
+		t.Fatalf("start position: got %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,182 @@
+package bus
+
+import (
+	"errors"
+	"sync"
+)
+
+// UnknownErrorClass is reported for errors that are not registered in the ErrorRegistry
+// It matches the base exception class of the Python side
+const UnknownErrorClass = "Exception"
+
+var (
+	// ErrNotFound signals that the requested entity does not exist
+	ErrNotFound = errors.New("not found")
+	// ErrValidation signals that the request failed validation
+	ErrValidation = errors.New("validation failed")
+	// ErrPermissionDenied signals that the caller is not allowed to perform the request
+	ErrPermissionDenied = errors.New("permission denied")
+)
+
+// DetailedError is implemented by errors that carry structured details for the caller
+// Details are sent in the error_details field of the TransportResponse
+type DetailedError interface {
+	error
+	ErrorDetails() map[string]any
+}
+
+// ResponseError is the error reconstructed from a TransportResponse
+// It carries the error message, class and details reported by the remote handler
+// and unwraps to the registered Go error for the class, so errors.Is and errors.As work
+type ResponseError struct {
+	Class   string
+	Message string
+	Details map[string]any
+	cause   error
+}
+
+// Error implements the error interface
+func (e *ResponseError) Error() string {
+	if e.Class == "" {
+		return e.Message
+	}
+	return e.Class + ": " + e.Message
+}
+
+// Unwrap returns the registered Go error for the class, nil when the class is unknown
+func (e *ResponseError) Unwrap() error {
+	return e.cause
+}
+
+// ErrorDetails implements DetailedError
+func (e *ResponseError) ErrorDetails() map[string]any {
+	return e.Details
+}
+
+// errorEntry maps one Go error to a stable class name
+type errorEntry struct {
+	class string
+	match func(err error) bool
+	build func(message string, details map[string]any) error
+}
+
+// ErrorRegistry maps Go error types and sentinel errors to stable class names
+// Class names are shared with the Python side, so use its exception names
+type ErrorRegistry struct {
+	mu      sync.RWMutex
+	entries []errorEntry
+}
+
+// NewErrorRegistry creates a registry with the built-in bus errors
+func NewErrorRegistry() *ErrorRegistry {
+	r := &ErrorRegistry{}
+	r.RegisterSentinel("NotFoundError", ErrNotFound)
+	r.RegisterSentinel("ValidationError", ErrValidation)
+	r.RegisterSentinel("PermissionError", ErrPermissionDenied)
+	r.RegisterSentinel("TimeoutError", ErrRequestTimeout)
+	RegisterErrorType(r, PanicErrorClass, func(message string, _ map[string]any) *PanicError {
+		return &PanicError{Value: message}
+	})
+	return r
+}
+
+// DefaultErrors is the registry used by buses without a custom registry
+var DefaultErrors = NewErrorRegistry()
+
+// RegisterSentinel maps a sentinel error to a class name
+// Errors wrapping the sentinel are reported with this class and reconstructed to match it with errors.Is
+func (r *ErrorRegistry) RegisterSentinel(class string, sentinel error) {
+	r.add(errorEntry{
+		class: class,
+		match: func(err error) bool {
+			return errors.Is(err, sentinel)
+		},
+		build: func(string, map[string]any) error {
+			return sentinel
+		},
+	})
+}
+
+// RegisterErrorType maps the error type E to a class name
+// build reconstructs E on the caller side so it can be extracted with errors.As
+func RegisterErrorType[E error](r *ErrorRegistry, class string, build func(message string, details map[string]any) E) {
+	r.add(errorEntry{
+		class: class,
+		match: func(err error) bool {
+			var target E
+			return errors.As(err, &target)
+		},
+		build: func(message string, details map[string]any) error {
+			return build(message, details)
+		},
+	})
+}
+
+// add appends an entry, later registrations take precedence
+func (r *ErrorRegistry) add(entry errorEntry) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.entries = append(r.entries, entry)
+}
+
+// Class returns the class name registered for the error or UnknownErrorClass
+// A forwarded *ResponseError keeps the class reported by the remote handler, registered or not
+func (r *ErrorRegistry) Class(err error) string {
+	var respErr *ResponseError
+	if errors.As(err, &respErr) && respErr.Class != "" {
+		return respErr.Class
+	}
+	if entry, ok := r.find(func(e errorEntry) bool { return e.match(err) }); ok {
+		return entry.class
+	}
+	return UnknownErrorClass
+}
+
+// Details returns the structured details of the error, nil when it has none
+func (r *ErrorRegistry) Details(err error) map[string]any {
+	var detailed DetailedError
+	if errors.As(err, &detailed) {
+		return detailed.ErrorDetails()
+	}
+	return nil
+}
+
+// Reconstruct builds the caller-side error for a class, message and details
+// The result is a *ResponseError that unwraps to the registered error for the class
+func (r *ErrorRegistry) Reconstruct(class, message string, details map[string]any) error {
+	respErr := &ResponseError{
+		Class:   class,
+		Message: message,
+		Details: details,
+	}
+	if entry, ok := r.find(func(e errorEntry) bool { return e.class == class }); ok {
+		respErr.cause = entry.build(message, details)
+	}
+	return respErr
+}
+
+// find returns the most recently registered entry satisfying the predicate
+func (r *ErrorRegistry) find(pred func(errorEntry) bool) (errorEntry, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for i := len(r.entries) - 1; i >= 0; i-- {
+		if pred(r.entries[i]) {
+			return r.entries[i], true
+		}
+	}
+	return errorEntry{}, false
+}
+
+// SetErrorRegistry sets the registry used to report handler errors and reconstruct response errors
+func (b *Bus) SetErrorRegistry(registry *ErrorRegistry) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.errRegistry = registry
+}
+
+// errorRegistry returns the registry of the bus
+func (b *Bus) errorRegistry() *ErrorRegistry {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.errRegistry
+}
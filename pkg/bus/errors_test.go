@@ -0,0 +1,56 @@
+package bus_test
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/PavelRadostev/toolkit/pkg/bus"
+)
+
+func TestErrorRegistryClass(t *testing.T) {
+	registry := bus.NewErrorRegistry()
+
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{"sentinel", bus.ErrNotFound, "NotFoundError"},
+		{"wrapped sentinel", fmt.Errorf("plan 7: %w", bus.ErrValidation), "ValidationError"},
+		{"panic", &bus.PanicError{Value: "boom"}, bus.PanicErrorClass},
+		{"unknown", errors.New("boom"), bus.UnknownErrorClass},
+		{"forwarded unregistered class", registry.Reconstruct("BillingLimitExceeded", "limit reached", nil), "BillingLimitExceeded"},
+		{"wrapped forwarded class", fmt.Errorf("billing: %w", registry.Reconstruct("BillingLimitExceeded", "limit reached", nil)), "BillingLimitExceeded"},
+		{"forwarded registered class", registry.Reconstruct("NotFoundError", "no plan", nil), "NotFoundError"},
+		{"forwarded without class", registry.Reconstruct("", "boom", nil), bus.UnknownErrorClass},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := registry.Class(tt.err); got != tt.want {
+				t.Fatalf("Class: got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestErrorRegistryReconstruct(t *testing.T) {
+	registry := bus.NewErrorRegistry()
+
+	err := registry.Reconstruct("NotFoundError", "no plan", map[string]any{"plan_id": 7})
+	if !errors.Is(err, bus.ErrNotFound) {
+		t.Fatalf("reconstructed error does not match ErrNotFound: %v", err)
+	}
+	var respErr *bus.ResponseError
+	if !errors.As(err, &respErr) || respErr.Message != "no plan" || respErr.Details["plan_id"] != 7 {
+		t.Fatalf("response error: %#v", err)
+	}
+
+	err = registry.Reconstruct("BillingLimitExceeded", "limit reached", nil)
+	if errors.Unwrap(err) != nil {
+		t.Fatalf("unknown class unwraps to %v", errors.Unwrap(err))
+	}
+	if got := err.Error(); got != "BillingLimitExceeded: limit reached" {
+		t.Fatalf("message: got %q", got)
+	}
+}
@@ -0,0 +1,131 @@
+package bus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime/debug"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+// ErrMixedStream is returned by Run when a stream has both a query handler and event handlers
+var ErrMixedStream = errors.New("stream has both a handler and event handlers")
+
+// RegisterEventHandler subscribes a handler constructor to an event stream
+// Every handler registered for the stream receives each event, in registration order
+// Each service reads event streams through its own consumer group, see SetConsumerGroup
+func (f *HandlerFactory) RegisterEventHandler(streamName string, constructor HandlerConstructor) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.events[streamName] = append(f.events[streamName], constructor)
+	f.log().Debug("Registered event handler", LogKeyStream, streamName, "handler", len(f.events[streamName]))
+}
+
+// HasEventHandlers checks if event handlers are registered for the given stream
+func (f *HandlerFactory) HasEventHandlers(streamName string) bool {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return len(f.events[streamName]) > 0
+}
+
+// validate checks that no stream is registered both as a query stream and as an event stream
+func (f *HandlerFactory) validate() error {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	for streamName := range f.events {
+		if _, ok := f.constructors[streamName]; ok {
+			return fmt.Errorf("%w: %s", ErrMixedStream, streamName)
+		}
+	}
+	return nil
+}
+
+// createEventHandler creates every event handler of the stream and combines them into one Subscriber
+func (f *HandlerFactory) createEventHandler(streamName string, data []byte) (Subscriber, error) {
+	f.mu.RLock()
+	constructors := f.events[streamName]
+	repo := f.repositories[streamName]
+	f.mu.RUnlock()
+
+	subscribers := make([]Subscriber, 0, len(constructors))
+	for i, constructor := range constructors {
+		subscriber, err := constructor(data, repo)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create event handler #%d for stream %s: %w", i+1, streamName, err)
+		}
+		subscribers = append(subscribers, subscriber)
+	}
+	return &eventFanout{stream: streamName, subscribers: subscribers, done: make([]bool, len(subscribers))}, nil
+}
+
+// eventFanout delivers one event to every local event handler
+// Handlers that succeeded are skipped when the event is retried
+type eventFanout struct {
+	stream      string
+	subscribers []Subscriber
+	done        []bool
+}
+
+// Handle implements Subscriber
+// Every pending handler runs even if an earlier one fails, the failures are joined
+func (e *eventFanout) Handle(ctx context.Context) (any, error) {
+	var errs []error
+	for i, subscriber := range e.subscribers {
+		if e.done[i] {
+			continue
+		}
+		if err := e.handleOne(ctx, i, subscriber); err != nil {
+			errs = append(errs, fmt.Errorf("event handler #%d: %w", i+1, err))
+			continue
+		}
+		e.done[i] = true
+	}
+	return nil, errors.Join(errs...)
+}
+
+// handleOne calls a single event handler, converting a panic into a *PanicError
+// so that the remaining handlers still receive the event
+func (e *eventFanout) handleOne(ctx context.Context, i int, subscriber Subscriber) (err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			panicErr := &PanicError{Value: v, Stack: debug.Stack()}
+			LoggerFromContext(ctx).Error("Recovered event handler panic", "handler", i+1, "panic", v, "stack", string(panicErr.Stack))
+			err = panicErr
+		}
+	}()
+	_, err = subscriber.Handle(ctx)
+	return err
+}
+
+// eventHandler adapts a typed event handler function to the Subscriber interface
+type eventHandler[E any] struct {
+	event E
+	fn    func(ctx context.Context, e E) error
+}
+
+// Handle implements Subscriber
+func (h *eventHandler[E]) Handle(ctx context.Context) (any, error) {
+	return nil, h.fn(ctx, h.event)
+}
+
+// HandleEvent subscribes a typed handler to the event stream
+// Properties are decoded into E; several handlers may subscribe to the same stream
+func HandleEvent[E any](factory *HandlerFactory, streamName string, fn func(ctx context.Context, e E) error) {
+	factory.RegisterEventHandler(streamName, func(data []byte, _ Repository) (Subscriber, error) {
+		var e E
+		if len(data) > 0 {
+			if err := cbor.Unmarshal(data, &e); err != nil {
+				return nil, fmt.Errorf("failed to decode %T: %w", e, err)
+			}
+		}
+		return &eventHandler[E]{event: e, fn: fn}, nil
+	})
+}
+
+// HandleEventWith subscribes a typed event handler that receives typed dependencies
+func HandleEventWith[D, E any](factory *HandlerFactory, streamName string, deps D, fn func(ctx context.Context, deps D, e E) error) {
+	HandleEvent(factory, streamName, func(ctx context.Context, e E) error {
+		return fn(ctx, deps, e)
+	})
+}
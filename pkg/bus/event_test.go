@@ -0,0 +1,67 @@
+package bus_test
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/PavelRadostev/toolkit/pkg/bus"
+)
+
+func TestEventFanOut(t *testing.T) {
+	transport := bus.NewMemoryTransport()
+	policy := bus.RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond}
+	var billing, notifications, reporting, failures atomic.Int32
+
+	// Handlers of one group share the delivery, a retry only reruns the ones that failed
+	billingFactory := bus.NewHandlerFactory()
+	bus.HandleEvent(billingFactory, "plans", func(ctx context.Context, j job) error {
+		billing.Add(1)
+		return nil
+	})
+	bus.HandleEvent(billingFactory, "plans", func(ctx context.Context, j job) error {
+		if failures.Add(1) == 1 {
+			return errors.New("smtp unavailable")
+		}
+		notifications.Add(1)
+		return nil
+	})
+	billingBus := newBus(transport, billingFactory)
+	billingBus.SetConsumerGroup("billing", "billing-1")
+	billingBus.Register("plans", bus.WithRetryPolicy(policy))
+	runBus(t, billingBus, transport, "billing", "plans")
+
+	// Every group gets its own copy of the event
+	reportingFactory := bus.NewHandlerFactory()
+	bus.HandleEvent(reportingFactory, "plans", func(ctx context.Context, j job) error {
+		reporting.Add(1)
+		return nil
+	})
+	reportingBus := newBus(transport, reportingFactory)
+	reportingBus.SetConsumerGroup("reporting", "reporting-1")
+	runBus(t, reportingBus, transport, "reporting", "plans")
+
+	if err := newBus(transport, nil).Emit(t.Context(), job{Stream: "plans", N: 7}); err != nil {
+		t.Fatalf("emit: %v", err)
+	}
+	eventually(t, time.Second, func() bool { return notifications.Load() == 1 && reporting.Load() == 1 })
+	if got := billing.Load(); got != 1 {
+		t.Fatalf("billing handler calls: got %d, want 1", got)
+	}
+	if got := failures.Load(); got != 2 {
+		t.Fatalf("notification handler calls: got %d, want 2", got)
+	}
+}
+
+func TestMixedStreamIsRejected(t *testing.T) {
+	factory := bus.NewHandlerFactory()
+	bus.Handle(factory, "plans", func(ctx context.Context, j job) (int, error) { return j.N, nil })
+	bus.HandleEvent(factory, "plans", func(ctx context.Context, j job) error { return nil })
+
+	b := newBus(bus.NewMemoryTransport(), factory)
+	if err := b.Run(t.Context()); !errors.Is(err, bus.ErrMixedStream) {
+		t.Fatalf("run: got %v, want ErrMixedStream", err)
+	}
+}
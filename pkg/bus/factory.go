@@ -2,7 +2,7 @@ package bus
 
 import (
 	"fmt"
-	"log"
+	"log/slog"
 	"sync"
 )
 
@@ -19,6 +19,9 @@ type HandlerFactory struct {
 	mu           sync.RWMutex
 	constructors map[string]HandlerConstructor
 	repositories map[string]Repository
+	middlewares  map[string][]HandlerMiddleware
+	events       map[string][]HandlerConstructor
+	logger       *slog.Logger
 }
 
 // NewHandlerFactory creates a new HandlerFactory instance
@@ -26,6 +29,8 @@ func NewHandlerFactory() *HandlerFactory {
 	return &HandlerFactory{
 		constructors: make(map[string]HandlerConstructor),
 		repositories: make(map[string]Repository),
+		middlewares:  make(map[string][]HandlerMiddleware),
+		events:       make(map[string][]HandlerConstructor),
 	}
 }
 
@@ -34,7 +39,7 @@ func (f *HandlerFactory) RegisterHandler(streamName string, constructor HandlerC
 	f.mu.Lock()
 	defer f.mu.Unlock()
 	f.constructors[streamName] = constructor
-	log.Printf("HandlerFactory: Registered handler constructor for stream: %s", streamName)
+	f.log().Debug("Registered handler constructor", LogKeyStream, streamName)
 }
 
 // RegisterRepository registers a repository for a specific stream
@@ -42,23 +47,45 @@ func (f *HandlerFactory) RegisterRepository(streamName string, repo Repository)
 	f.mu.Lock()
 	defer f.mu.Unlock()
 	f.repositories[streamName] = repo
-	log.Printf("HandlerFactory: Registered repository for stream: %s", streamName)
+	f.log().Debug("Registered repository", LogKeyStream, streamName)
+}
+
+// Use registers middleware for a specific stream
+// Stream middleware runs inside the middleware registered globally on the Bus
+func (f *HandlerFactory) Use(streamName string, mw ...HandlerMiddleware) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.middlewares[streamName] = append(f.middlewares[streamName], mw...)
+}
+
+// middleware returns the middleware registered for the stream
+func (f *HandlerFactory) middleware(streamName string) []HandlerMiddleware {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.middlewares[streamName]
 }
 
 // CreateHandler creates a handler instance for the given stream using registered constructor and repository
+// For event streams the returned handler delivers the event to every event handler of the stream
 func (f *HandlerFactory) CreateHandler(streamName string, data []byte) (Subscriber, error) {
 	f.mu.RLock()
 	constructor, hasConstructor := f.constructors[streamName]
 	repo, hasRepo := f.repositories[streamName]
+	isEvent := len(f.events[streamName]) > 0
+	logger := f.log()
 	f.mu.RUnlock()
 
+	if isEvent && !hasConstructor {
+		return f.createEventHandler(streamName, data)
+	}
+
 	if !hasConstructor {
 		return nil, fmt.Errorf("no handler constructor registered for stream: %s", streamName)
 	}
 
 	// Repository is optional - pass nil if not registered
 	if !hasRepo {
-		log.Printf("HandlerFactory: No repository registered for stream: %s, creating handler without repository", streamName)
+		logger.Debug("No repository registered, creating handler without repository", LogKeyStream, streamName)
 	}
 
 	return constructor(data, repo)
@@ -72,13 +99,18 @@ func (f *HandlerFactory) HasHandler(streamName string) bool {
 	return exists
 }
 
-// GetStreams returns all registered stream names
+// GetStreams returns all registered stream names, event streams included
 func (f *HandlerFactory) GetStreams() []string {
 	f.mu.RLock()
 	defer f.mu.RUnlock()
-	streams := make([]string, 0, len(f.constructors))
+	streams := make([]string, 0, len(f.constructors)+len(f.events))
 	for streamName := range f.constructors {
 		streams = append(streams, streamName)
 	}
+	for streamName := range f.events {
+		if _, ok := f.constructors[streamName]; !ok {
+			streams = append(streams, streamName)
+		}
+	}
 	return streams
 }
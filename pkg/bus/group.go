@@ -0,0 +1,172 @@
+package bus
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+)
+
+const (
+	// DefaultConsumerGroup is the consumer group used when none is configured
+	DefaultConsumerGroup = "default"
+
+	// claimBatchSize is the maximum number of pending entries reclaimed per XAUTOCLAIM call
+	claimBatchSize = 10
+)
+
+// ClaimPolicy controls how pending entries of dead consumers are reclaimed
+type ClaimPolicy struct {
+	// Interval between XAUTOCLAIM runs, zero disables reclaiming
+	Interval time.Duration
+	// MinIdle is how long an entry must stay unacknowledged before it is reclaimed
+	MinIdle time.Duration
+}
+
+// DefaultClaimPolicy returns the claim policy used by NewBus
+func DefaultClaimPolicy() ClaimPolicy {
+	return ClaimPolicy{
+		Interval: 30 * time.Second,
+		MinIdle:  time.Minute,
+	}
+}
+
+// SetConsumerGroup sets the consumer group and consumer names used to read streams
+// Replicas of one service share the group and must use distinct consumer names
+func (b *Bus) SetConsumerGroup(group, consumer string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if group != "" {
+		b.group = group
+	}
+	if consumer != "" {
+		b.consumer = consumer
+	}
+}
+
+// SetClaimPolicy sets the policy for reclaiming stale pending entries
+func (b *Bus) SetClaimPolicy(policy ClaimPolicy) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.claim = policy
+}
+
+// defaultConsumerName builds a consumer name unique per process
+func defaultConsumerName() string {
+	host, err := os.Hostname()
+	if err != nil || host == "" {
+		host = "consumer"
+	}
+	return fmt.Sprintf("%s-%d", host, os.Getpid())
+}
+
+// ensureGroup creates the consumer group for the stream if it does not exist yet
+// New groups start at the stream start position, by default only entries added after creation are delivered
+func (b *Bus) ensureGroup(streamName string) error {
+	return b.transport.CreateGroup(b.ctx, streamName, b.group, b.streamConfig(streamName).start.groupStart())
+}
+
+// ack acknowledges a processed entry in the consumer group
+// Uses its own context so that entries finished during shutdown are still acknowledged
+func (b *Bus) ack(streamName string, redisMessageID string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := b.transport.Ack(ctx, streamName, b.group, redisMessageID); err != nil {
+		b.log().Error("Failed to ack message", LogKeyStream, streamName, LogKeyRedisMessageID, redisMessageID, LogKeyError, err)
+	}
+}
+
+// claimStale periodically takes over entries left pending by dead consumers
+func (b *Bus) claimStale(streamName string, pool *workerPool) {
+	b.mu.RLock()
+	policy := b.claim
+	b.mu.RUnlock()
+
+	if policy.Interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(policy.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-b.ctx.Done():
+			return
+		case <-ticker.C:
+			b.claimPending(streamName, pool, policy.MinIdle)
+		}
+	}
+}
+
+// claimPending walks the pending entries list once and hands reclaimed entries to the worker pool
+func (b *Bus) claimPending(streamName string, pool *workerPool, minIdle time.Duration) {
+	start := "0-0"
+	for {
+		reserved := pool.reserve(b.ctx, claimBatchSize)
+		if reserved == 0 {
+			return
+		}
+
+		msgs, next, err := b.transport.Claim(b.ctx, streamName, b.group, b.consumer, minIdle, start, reserved)
+		if err != nil {
+			pool.release(reserved)
+			if b.ctx.Err() == nil {
+				b.log().Error("Failed to claim pending messages", LogKeyStream, streamName, LogKeyError, err)
+			}
+			return
+		}
+
+		for _, msg := range msgs {
+			if pool.isRunning(msg.ID) {
+				// A slow handler of this consumer, claiming only refreshed its idle time
+				continue
+			}
+			b.log().Info("Reclaimed pending message", LogKeyStream, streamName, LogKeyRedisMessageID, msg.ID)
+			reserved--
+			pool.run(msg.ID, func() {
+				b.handleEntry(streamName, msg)
+			})
+		}
+		pool.release(reserved)
+
+		// "0-0" means the whole pending entries list has been scanned
+		if next == "0-0" || next == "" {
+			return
+		}
+		start = next
+	}
+}
+
+// touchRunning keeps resetting the idle time of entries being handled, so that no consumer
+// reclaims an entry whose handler runs longer than ClaimPolicy.MinIdle
+// Entries are touched three times per MinIdle, replicas are expected to share the claim policy
+func (b *Bus) touchRunning(streamName string, pool *workerPool) {
+	b.mu.RLock()
+	minIdle := b.claim.MinIdle
+	b.mu.RUnlock()
+
+	if minIdle <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(max(minIdle/3, time.Millisecond))
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-b.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		ids := pool.runningIDs()
+		if len(ids) == 0 {
+			continue
+		}
+		if err := b.transport.Touch(b.ctx, streamName, b.group, b.consumer, ids...); err != nil && b.ctx.Err() == nil {
+			b.log().Warn("Failed to refresh pending messages", LogKeyStream, streamName, LogKeyError, err)
+		}
+	}
+}
@@ -0,0 +1,272 @@
+package bus_test
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/PavelRadostev/toolkit/pkg/bus"
+)
+
+func TestConcurrencyLimitAcrossStreams(t *testing.T) {
+	transport := bus.NewMemoryTransport()
+	var running, peak, handled atomic.Int32
+	handle := func(ctx context.Context, j job) (int, error) {
+		n := running.Add(1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		running.Add(-1)
+		handled.Add(1)
+		return j.N, nil
+	}
+	factory := bus.NewHandlerFactory()
+	bus.Handle(factory, "jobs.a", handle)
+	bus.Handle(factory, "jobs.b", handle)
+
+	b := newBus(transport, factory)
+	b.SetConcurrencyLimit(3)
+	b.Register("jobs.a", bus.WithWorkers(4))
+	b.Register("jobs.b", bus.WithWorkers(4))
+	runBus(t, b, transport, bus.DefaultConsumerGroup, "jobs.a", "jobs.b")
+
+	for i := range 12 {
+		stream := "jobs.a"
+		if i%2 == 1 {
+			stream = "jobs.b"
+		}
+		if err := b.Emit(t.Context(), job{Stream: stream, N: i}); err != nil {
+			t.Fatalf("emit: %v", err)
+		}
+	}
+
+	eventually(t, 5*time.Second, func() bool { return handled.Load() == 12 })
+	if got := peak.Load(); got > 3 {
+		t.Fatalf("peak concurrency: got %d, want at most 3", got)
+	}
+}
+
+func TestShutdownWaitsForRunningHandlers(t *testing.T) {
+	transport := bus.NewMemoryTransport()
+	started := make(chan struct{})
+	var finished atomic.Bool
+	factory := bus.NewHandlerFactory()
+	bus.Handle(factory, "jobs", func(ctx context.Context, j job) (int, error) {
+		close(started)
+		time.Sleep(100 * time.Millisecond)
+		finished.Store(true)
+		return j.N, ctx.Err()
+	})
+
+	b := newBus(transport, factory)
+	b.Register("jobs")
+	if err := transport.CreateGroup(t.Context(), "jobs", bus.DefaultConsumerGroup, "$"); err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error, 1)
+	go func() { done <- b.Run(context.Background()) }()
+
+	if err := b.Emit(t.Context(), job{Stream: "jobs", N: 1}); err != nil {
+		t.Fatalf("emit: %v", err)
+	}
+	<-started
+	b.Stop()
+	if err := <-done; err != nil {
+		t.Fatalf("run: %v", err)
+	}
+
+	if !finished.Load() {
+		t.Fatal("Stop returned before the running handler finished")
+	}
+	if ids := pendingIDs(t, transport, "jobs", bus.DefaultConsumerGroup); len(ids) != 0 {
+		t.Fatalf("handled entry left pending: %v", ids)
+	}
+}
+
+func TestShutdownTimeoutLeavesEntryPending(t *testing.T) {
+	transport := bus.NewMemoryTransport()
+	started := make(chan struct{})
+	factory := bus.NewHandlerFactory()
+	bus.Handle(factory, "jobs", func(ctx context.Context, j job) (int, error) {
+		close(started)
+		<-ctx.Done()
+		return 0, ctx.Err()
+	})
+
+	b := newBus(transport, factory)
+	b.SetShutdownTimeout(20 * time.Millisecond)
+	b.Register("jobs")
+	if err := transport.CreateGroup(t.Context(), "jobs", bus.DefaultConsumerGroup, "$"); err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error, 1)
+	go func() { done <- b.Run(context.Background()) }()
+
+	if err := b.Emit(t.Context(), job{Stream: "jobs", N: 1}); err != nil {
+		t.Fatalf("emit: %v", err)
+	}
+	<-started
+	b.Stop()
+	if err := <-done; err != nil {
+		t.Fatalf("run: %v", err)
+	}
+
+	if ids := pendingIDs(t, transport, "jobs", bus.DefaultConsumerGroup); len(ids) != 1 {
+		t.Fatalf("cancelled entry must stay pending for another consumer, pending: %v", ids)
+	}
+	if n, err := transport.GroupLag(t.Context(), "jobs.dlq", bus.DefaultConsumerGroup); err == nil && n > 0 {
+		t.Fatal("cancelled entry was dead-lettered")
+	}
+}
+
+func TestShutdownLeavesUnstartedEntriesUndelivered(t *testing.T) {
+	transport := bus.NewMemoryTransport()
+	started := make(chan struct{}, 4)
+	release := make(chan struct{})
+	factory := bus.NewHandlerFactory()
+	bus.Handle(factory, "jobs", func(ctx context.Context, j job) (int, error) {
+		started <- struct{}{}
+		<-release
+		return j.N, nil
+	})
+
+	b := newBus(transport, factory)
+	b.SetConcurrencyLimit(1)
+	b.Register("jobs", bus.WithWorkers(4))
+	if err := transport.CreateGroup(t.Context(), "jobs", bus.DefaultConsumerGroup, "$"); err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error, 1)
+	go func() { done <- b.Run(context.Background()) }()
+
+	for i := range 3 {
+		if err := b.Emit(t.Context(), job{Stream: "jobs", N: i}); err != nil {
+			t.Fatalf("emit: %v", err)
+		}
+	}
+	<-started
+	// Give the stream loop time to read more entries if it would
+	time.Sleep(50 * time.Millisecond)
+
+	stopped := make(chan struct{})
+	go func() {
+		b.Stop()
+		close(stopped)
+	}()
+	// The running handler finishes after the bus stopped reading
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	<-stopped
+	if err := <-done; err != nil {
+		t.Fatalf("run: %v", err)
+	}
+
+	if ids := pendingIDs(t, transport, "jobs", bus.DefaultConsumerGroup); len(ids) != 0 {
+		t.Fatalf("entries read but not handled were left pending: %v", ids)
+	}
+	if lag, err := transport.GroupLag(t.Context(), "jobs", bus.DefaultConsumerGroup); err != nil || lag != 2 {
+		t.Fatalf("undelivered entries: got %d (%v), want 2", lag, err)
+	}
+}
+
+func TestClaimReclaimsEntriesOfDeadConsumer(t *testing.T) {
+	transport := bus.NewMemoryTransport()
+	var handled atomic.Int32
+	factory := bus.NewHandlerFactory()
+	bus.Handle(factory, "jobs", func(ctx context.Context, j job) (int, error) {
+		handled.Add(1)
+		return j.N, nil
+	})
+
+	if err := transport.CreateGroup(t.Context(), "jobs", bus.DefaultConsumerGroup, "$"); err != nil {
+		t.Fatal(err)
+	}
+	sender := newBus(transport, nil)
+	if err := sender.Emit(t.Context(), job{Stream: "jobs", N: 1}); err != nil {
+		t.Fatalf("emit: %v", err)
+	}
+	// A consumer reads the entry and dies before acknowledging it
+	entries, err := transport.ReadGroup(t.Context(), "jobs", bus.DefaultConsumerGroup, "dead", 1, 0)
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("read as dead consumer: %v, %v", entries, err)
+	}
+
+	b := newBus(transport, factory)
+	b.SetClaimPolicy(bus.ClaimPolicy{Interval: 10 * time.Millisecond, MinIdle: 30 * time.Millisecond})
+	// A worker stays free for the claimer while the stream loop blocks in a read
+	b.Register("jobs", bus.WithWorkers(2), bus.WithBatchSize(1))
+	runBus(t, b, transport, bus.DefaultConsumerGroup)
+
+	eventually(t, 2*time.Second, func() bool { return handled.Load() == 1 })
+	eventually(t, time.Second, func() bool {
+		return len(pendingIDs(t, transport, "jobs", bus.DefaultConsumerGroup)) == 0
+	})
+}
+
+func TestClaimSkipsEntriesStillBeingHandled(t *testing.T) {
+	transport := bus.NewMemoryTransport()
+	var calls atomic.Int32
+	finished := make(chan struct{}, 2)
+	factory := bus.NewHandlerFactory()
+	bus.Handle(factory, "jobs", func(ctx context.Context, j job) (int, error) {
+		calls.Add(1)
+		// Runs for several MinIdle periods
+		time.Sleep(200 * time.Millisecond)
+		finished <- struct{}{}
+		return j.N, nil
+	})
+
+	if err := transport.CreateGroup(t.Context(), "jobs", bus.DefaultConsumerGroup, "$"); err != nil {
+		t.Fatal(err)
+	}
+	policy := bus.ClaimPolicy{Interval: 5 * time.Millisecond, MinIdle: 30 * time.Millisecond}
+	for _, consumer := range []string{"first", "second"} {
+		b := newBus(transport, factory)
+		b.SetConsumerGroup(bus.DefaultConsumerGroup, consumer)
+		b.SetClaimPolicy(policy)
+		b.Register("jobs", bus.WithWorkers(2), bus.WithBatchSize(1))
+		runBus(t, b, transport, bus.DefaultConsumerGroup)
+	}
+
+	sender := newBus(transport, nil)
+	if err := sender.Emit(t.Context(), job{Stream: "jobs", N: 1}); err != nil {
+		t.Fatalf("emit: %v", err)
+	}
+	<-finished
+	// Leave time for a late duplicate to show up
+	time.Sleep(50 * time.Millisecond)
+	if got := calls.Load(); got != 1 {
+		t.Fatalf("handler calls: got %d, want 1", got)
+	}
+}
+
+// failingReadTransport fails every consumer group read and counts the attempts
+type failingReadTransport struct {
+	*bus.MemoryTransport
+	reads atomic.Int32
+}
+
+func (t *failingReadTransport) ReadGroup(ctx context.Context, stream, group, consumer string, count int, block time.Duration) ([]bus.Entry, error) {
+	t.reads.Add(1)
+	return nil, errors.New("connection refused")
+}
+
+func TestReadErrorsBackOff(t *testing.T) {
+	transport := &failingReadTransport{MemoryTransport: bus.NewMemoryTransport()}
+	factory := bus.NewHandlerFactory()
+	bus.Handle(factory, "jobs", func(ctx context.Context, j job) (int, error) { return 0, nil })
+	b := newBus(transport, factory)
+	b.Register("jobs")
+	runBus(t, b, transport, bus.DefaultConsumerGroup, "jobs")
+
+	time.Sleep(200 * time.Millisecond)
+	if n := transport.reads.Load(); n != 1 {
+		t.Fatalf("reads after a failure: got %d, want 1 before the backoff ends", n)
+	}
+}
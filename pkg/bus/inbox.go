@@ -0,0 +1,252 @@
+package bus
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// DefaultInboxTTL is how long processed request IDs are remembered
+	DefaultInboxTTL = 24 * time.Hour
+	// DefaultInboxClaimTTL is how long a claimed request stays claimed without a response,
+	// so a request whose consumer died is handled again after that
+	DefaultInboxClaimTTL = 5 * time.Minute
+
+	// inboxKeyPrefix prefixes Redis keys of processed requests
+	inboxKeyPrefix = "bus:inbox:"
+)
+
+// Inbox remembers processed request IDs of a stream together with the encoded response
+// With an inbox the bus skips duplicates of handled requests and replays the stored response
+// A request is claimed before it is handled, so concurrent deliveries of one request run the handler once
+type Inbox interface {
+	// Claim atomically records the request as being handled, claimed is true when this call recorded it
+	// Otherwise response holds the stored encoded TransportResponse, nil while the request is still being handled
+	Claim(ctx context.Context, stream, requestID string) (response []byte, claimed bool, err error)
+	// Put records the request as processed with its encoded TransportResponse, replacing the claim
+	Put(ctx context.Context, stream, requestID string, response []byte) error
+	// Release drops the claim of a request that was not processed, so its next delivery is handled again
+	// A stored response is kept
+	Release(ctx context.Context, stream, requestID string) error
+}
+
+// WithInbox enables deduplication of the stream by request ID
+// Only successfully handled requests are recorded, failed ones run again when redelivered
+func WithInbox(inbox Inbox) StreamOption {
+	return func(c *streamConfig) {
+		c.inbox = inbox
+	}
+}
+
+// RedisInboxClient defines the Redis operations used by RedisInbox
+type RedisInboxClient interface {
+	Get(ctx context.Context, key string) *redis.StringCmd
+	Set(ctx context.Context, key string, value interface{}, expiration time.Duration) *redis.StatusCmd
+	SetNX(ctx context.Context, key string, value interface{}, expiration time.Duration) *redis.BoolCmd
+	redis.Scripter
+}
+
+// releaseClaimScript deletes the key only while it holds the empty claim marker,
+// so a response stored in the meantime is kept
+var releaseClaimScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == '' then
+	return redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+
+// RedisInbox implements Inbox with Redis keys expiring after the TTL
+// A claimed request is stored as an empty value until its response replaces it
+type RedisInbox struct {
+	client   RedisInboxClient
+	ttl      time.Duration
+	claimTTL time.Duration
+}
+
+// NewRedisInbox creates an Inbox backed by Redis, a non-positive ttl means DefaultInboxTTL
+func NewRedisInbox(client RedisInboxClient, ttl time.Duration) *RedisInbox {
+	if ttl <= 0 {
+		ttl = DefaultInboxTTL
+	}
+	return &RedisInbox{client: client, ttl: ttl, claimTTL: DefaultInboxClaimTTL}
+}
+
+// SetClaimTTL sets how long a request stays claimed without a response
+func (i *RedisInbox) SetClaimTTL(ttl time.Duration) {
+	if ttl > 0 {
+		i.claimTTL = ttl
+	}
+}
+
+// Claim implements Inbox with SET NX of the empty claim marker
+func (i *RedisInbox) Claim(ctx context.Context, stream, requestID string) ([]byte, bool, error) {
+	key := inboxKey(stream, requestID)
+	claimed, err := i.client.SetNX(ctx, key, "", i.claimTTL).Result()
+	if err != nil || claimed {
+		return nil, claimed, err
+	}
+
+	data, err := i.client.Get(ctx, key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		// Expired in between, the next delivery claims it
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	if len(data) == 0 {
+		return nil, false, nil
+	}
+	return data, false, nil
+}
+
+// Put implements Inbox
+func (i *RedisInbox) Put(ctx context.Context, stream, requestID string, response []byte) error {
+	return i.client.Set(ctx, inboxKey(stream, requestID), response, i.ttl).Err()
+}
+
+// Release implements Inbox
+func (i *RedisInbox) Release(ctx context.Context, stream, requestID string) error {
+	return releaseClaimScript.Run(ctx, i.client, []string{inboxKey(stream, requestID)}).Err()
+}
+
+// inboxKey builds the Redis key of a processed request
+func inboxKey(stream, requestID string) string {
+	return inboxKeyPrefix + stream + ":" + requestID
+}
+
+// MemoryInbox implements Inbox in process memory, for tests and local development
+type MemoryInbox struct {
+	mu       sync.Mutex
+	ttl      time.Duration
+	claimTTL time.Duration
+	entries  map[string]memoryInboxEntry
+}
+
+// memoryInboxEntry is a request stored by MemoryInbox, a nil response means it is claimed
+type memoryInboxEntry struct {
+	response  []byte
+	expiresAt time.Time
+}
+
+// NewMemoryInbox creates an in-memory Inbox, a non-positive ttl means DefaultInboxTTL
+func NewMemoryInbox(ttl time.Duration) *MemoryInbox {
+	if ttl <= 0 {
+		ttl = DefaultInboxTTL
+	}
+	return &MemoryInbox{ttl: ttl, claimTTL: DefaultInboxClaimTTL, entries: make(map[string]memoryInboxEntry)}
+}
+
+// SetClaimTTL sets how long a request stays claimed without a response
+func (i *MemoryInbox) SetClaimTTL(ttl time.Duration) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if ttl > 0 {
+		i.claimTTL = ttl
+	}
+}
+
+// Claim implements Inbox
+func (i *MemoryInbox) Claim(_ context.Context, stream, requestID string) ([]byte, bool, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	key := inboxKey(stream, requestID)
+	if entry, ok := i.entries[key]; ok && time.Now().Before(entry.expiresAt) {
+		return entry.response, false, nil
+	}
+	i.entries[key] = memoryInboxEntry{expiresAt: time.Now().Add(i.claimTTL)}
+	return nil, true, nil
+}
+
+// Put implements Inbox
+func (i *MemoryInbox) Put(_ context.Context, stream, requestID string, response []byte) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	i.entries[inboxKey(stream, requestID)] = memoryInboxEntry{
+		response:  response,
+		expiresAt: time.Now().Add(i.ttl),
+	}
+	return nil
+}
+
+// Release implements Inbox
+func (i *MemoryInbox) Release(_ context.Context, stream, requestID string) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	key := inboxKey(stream, requestID)
+	if entry, ok := i.entries[key]; ok && entry.response == nil {
+		delete(i.entries, key)
+	}
+	return nil
+}
+
+// inboxClaim is the outcome of claiming a request in the stream inbox
+type inboxClaim int
+
+const (
+	// inboxClaimed means the request is seen for the first time and must be handled
+	inboxClaimed inboxClaim = iota
+	// inboxProcessed means the request was handled before and its stored response has been replayed
+	inboxProcessed
+	// inboxBusy means another delivery of the request is still being handled
+	inboxBusy
+)
+
+// claimInbox claims the request in the stream inbox before it is handled
+func (b *Bus) claimInbox(streamName string, inbox Inbox, req *TransportRequest) (inboxClaim, error) {
+	ctx, cancel := context.WithTimeout(b.handleCtx, 5*time.Second)
+	defer cancel()
+
+	response, claimed, err := inbox.Claim(ctx, streamName, req.RequestID)
+	if err != nil {
+		return inboxBusy, err
+	}
+	if claimed {
+		return inboxClaimed, nil
+	}
+	if response == nil {
+		return inboxBusy, nil
+	}
+
+	requestLogger(b.log(), streamName, req).Info("Skipping duplicate message")
+	if req.NeedsResponse() {
+		b.pushResponse(streamName, req.RequestID, req.RedisMessageID, response)
+	}
+	return inboxProcessed, nil
+}
+
+// releaseInbox drops the inbox claim of a request that was not processed
+func (b *Bus) releaseInbox(streamName string, inbox Inbox, req *TransportRequest) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := inbox.Release(ctx, streamName, req.RequestID); err != nil {
+		requestLogger(b.log(), streamName, req).Error("Failed to release inbox claim", LogKeyError, err)
+	}
+}
+
+// respondAndRemember records a successfully handled request in the stream inbox and answers the caller
+// The request is recorded before the response is sent, so a crash in between replays the same response
+func (b *Bus) respondAndRemember(streamName string, inbox Inbox, req *TransportRequest, response Response) {
+	data, err := b.encodeResponse(req.RequestID, response)
+	if err != nil {
+		requestLogger(b.log(), streamName, req).Error("Failed to encode TransportResponse", LogKeyError, err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := inbox.Put(ctx, streamName, req.RequestID, data); err != nil {
+		requestLogger(b.log(), streamName, req).Error("Failed to record request in inbox", LogKeyError, err)
+	}
+
+	if req.NeedsResponse() {
+		b.pushResponse(streamName, req.RequestID, req.RedisMessageID, data)
+	}
+}
@@ -0,0 +1,146 @@
+// Package inbox stores processed bus request IDs in Postgres
+//
+// Store implements bus.Inbox; enable it per stream with bus.WithInbox
+package inbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/PavelRadostev/toolkit/pkg/bus"
+	"github.com/PavelRadostev/toolkit/pkg/db"
+	"github.com/jackc/pgx/v5"
+)
+
+// Table is the inbox table created by migrations/000002_create_bus_inbox.up.sql
+const Table = "bus_inbox"
+
+// cleanupInterval is how often Run deletes expired rows
+const cleanupInterval = 10 * time.Minute
+
+// Store implements bus.Inbox with a Postgres table
+// A claimed request is a row with a NULL response until its response replaces it
+// Rows older than the TTL are ignored and deleted by Cleanup
+type Store struct {
+	pool     *db.Pool
+	ttl      time.Duration
+	claimTTL time.Duration
+	logger   *slog.Logger
+}
+
+// NewStore creates a Postgres inbox, a non-positive ttl means bus.DefaultInboxTTL
+func NewStore(pool *db.Pool, ttl time.Duration) *Store {
+	if ttl <= 0 {
+		ttl = bus.DefaultInboxTTL
+	}
+	return &Store{pool: pool, ttl: ttl, claimTTL: bus.DefaultInboxClaimTTL}
+}
+
+// SetClaimTTL sets how long a request stays claimed without a response
+func (s *Store) SetClaimTTL(ttl time.Duration) {
+	if ttl > 0 {
+		s.claimTTL = ttl
+	}
+}
+
+// SetLogger sets the logger used by Run, nil means slog.Default()
+func (s *Store) SetLogger(logger *slog.Logger) {
+	s.logger = logger
+}
+
+// Claim implements bus.Inbox
+// The insert takes over a row whose claim or response has expired, so a stale row does not block the request
+func (s *Store) Claim(ctx context.Context, stream, requestID string) ([]byte, bool, error) {
+	now := time.Now()
+	var claimed bool
+	err := s.pool.QueryRow(ctx,
+		`INSERT INTO `+Table+` AS t (stream, request_id, response) VALUES ($1, $2, NULL)
+		ON CONFLICT (stream, request_id) DO UPDATE SET response = NULL, processed_at = now()
+		WHERE t.processed_at < $3 OR (t.response IS NULL AND t.processed_at < $4)
+		RETURNING true`,
+		stream, requestID, now.Add(-s.ttl), now.Add(-s.claimTTL),
+	).Scan(&claimed)
+	if err == nil {
+		return nil, true, nil
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return nil, false, fmt.Errorf("failed to claim inbox row: %w", err)
+	}
+
+	var response []byte
+	err = s.pool.QueryRow(ctx,
+		`SELECT response FROM `+Table+` WHERE stream = $1 AND request_id = $2`,
+		stream, requestID,
+	).Scan(&response)
+	if errors.Is(err, pgx.ErrNoRows) {
+		// Released in between, the next delivery claims it
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to select inbox row: %w", err)
+	}
+	return response, false, nil
+}
+
+// Put implements bus.Inbox
+// The response replaces the claim or an expired row, a live response stays the first one
+func (s *Store) Put(ctx context.Context, stream, requestID string, response []byte) error {
+	_, err := s.pool.Exec(ctx,
+		`INSERT INTO `+Table+` AS t (stream, request_id, response) VALUES ($1, $2, $3)
+		ON CONFLICT (stream, request_id) DO UPDATE SET response = EXCLUDED.response, processed_at = now()
+		WHERE t.response IS NULL OR t.processed_at < $4`,
+		stream, requestID, response, time.Now().Add(-s.ttl),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to insert inbox row: %w", err)
+	}
+	return nil
+}
+
+// Release implements bus.Inbox
+func (s *Store) Release(ctx context.Context, stream, requestID string) error {
+	_, err := s.pool.Exec(ctx,
+		`DELETE FROM `+Table+` WHERE stream = $1 AND request_id = $2 AND response IS NULL`,
+		stream, requestID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to release inbox row: %w", err)
+	}
+	return nil
+}
+
+// Cleanup deletes rows older than the TTL and returns how many were deleted
+func (s *Store) Cleanup(ctx context.Context) (int64, error) {
+	tag, err := s.pool.Exec(ctx,
+		`DELETE FROM `+Table+` WHERE processed_at < $1`,
+		time.Now().Add(-s.ttl),
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete expired inbox rows: %w", err)
+	}
+	return tag.RowsAffected(), nil
+}
+
+// Run deletes expired rows periodically until ctx is done
+func (s *Store) Run(ctx context.Context) error {
+	ticker := time.NewTicker(cleanupInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			if _, err := s.Cleanup(ctx); err != nil && ctx.Err() == nil {
+				logger := s.logger
+				if logger == nil {
+					logger = slog.Default()
+				}
+				logger.Error("Failed to clean up inbox", bus.LogKeyError, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,217 @@
+package inbox_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/PavelRadostev/toolkit/pkg/bus/inbox"
+	"github.com/PavelRadostev/toolkit/pkg/db"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// newPool connects to the database in BUS_TEST_POSTGRES_DSN and creates the inbox table in a schema
+// of its own, dropped when the test ends; the test is skipped when the variable is not set
+func newPool(t *testing.T) *db.Pool {
+	t.Helper()
+
+	dsn := os.Getenv("BUS_TEST_POSTGRES_DSN")
+	if dsn == "" {
+		t.Skip("BUS_TEST_POSTGRES_DSN is not set")
+	}
+	ctx := context.Background()
+
+	admin, err := pgx.Connect(ctx, dsn)
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	schema := fmt.Sprintf("bus_inbox_test_%d", time.Now().UnixNano())
+	if _, err := admin.Exec(ctx, "CREATE SCHEMA "+schema); err != nil {
+		t.Fatalf("create schema: %v", err)
+	}
+	t.Cleanup(func() {
+		if _, err := admin.Exec(context.Background(), "DROP SCHEMA "+schema+" CASCADE"); err != nil {
+			t.Errorf("drop schema: %v", err)
+		}
+		admin.Close(context.Background())
+	})
+
+	cfg, err := pgxpool.ParseConfig(dsn)
+	if err != nil {
+		t.Fatalf("parse DSN: %v", err)
+	}
+	cfg.ConnConfig.RuntimeParams["search_path"] = schema
+	pool, err := pgxpool.NewWithConfig(ctx, cfg)
+	if err != nil {
+		t.Fatalf("create pool: %v", err)
+	}
+	t.Cleanup(pool.Close)
+
+	migration, err := os.ReadFile("../../../migrations/000002_create_bus_inbox.up.sql")
+	if err != nil {
+		t.Fatalf("read migration: %v", err)
+	}
+	if _, err := pool.Exec(ctx, string(migration)); err != nil {
+		t.Fatalf("apply migration: %v", err)
+	}
+	return &db.Pool{Pool: pool}
+}
+
+// backdate moves the row of the request age into the past
+func backdate(t *testing.T, pool *db.Pool, requestID string, age time.Duration) {
+	t.Helper()
+
+	if _, err := pool.Exec(t.Context(),
+		`UPDATE `+inbox.Table+` SET processed_at = $2 WHERE request_id = $1`,
+		requestID, time.Now().Add(-age),
+	); err != nil {
+		t.Fatalf("backdate %s: %v", requestID, err)
+	}
+}
+
+// rows returns the number of rows stored for the request
+func rows(t *testing.T, pool *db.Pool, requestID string) int {
+	t.Helper()
+
+	var n int
+	if err := pool.QueryRow(t.Context(),
+		`SELECT count(*) FROM `+inbox.Table+` WHERE request_id = $1`, requestID,
+	).Scan(&n); err != nil {
+		t.Fatalf("count rows of %s: %v", requestID, err)
+	}
+	return n
+}
+
+func TestStoreClaimPutRelease(t *testing.T) {
+	pool := newPool(t)
+	store := inbox.NewStore(pool, time.Hour)
+	ctx := t.Context()
+
+	if resp, claimed, err := store.Claim(ctx, "jobs", "req-1"); err != nil || !claimed || resp != nil {
+		t.Fatalf("first claim: got %q, %v (%v), want claimed", resp, claimed, err)
+	}
+	// The request is being handled, a second delivery must neither claim it nor see a response
+	if resp, claimed, err := store.Claim(ctx, "jobs", "req-1"); err != nil || claimed || resp != nil {
+		t.Fatalf("second claim: got %q, %v (%v), want in progress", resp, claimed, err)
+	}
+	// The same request ID on another stream is a different request
+	if _, claimed, err := store.Claim(ctx, "other", "req-1"); err != nil || !claimed {
+		t.Fatalf("claim on another stream: got %v (%v), want claimed", claimed, err)
+	}
+
+	if err := store.Put(ctx, "jobs", "req-1", []byte("first")); err != nil {
+		t.Fatalf("put: %v", err)
+	}
+	if resp, claimed, err := store.Claim(ctx, "jobs", "req-1"); err != nil || claimed || string(resp) != "first" {
+		t.Fatalf("claim after put: got %q, %v (%v), want the stored response", resp, claimed, err)
+	}
+
+	// A live response stays the first one and survives Release
+	if err := store.Put(ctx, "jobs", "req-1", []byte("second")); err != nil {
+		t.Fatalf("put again: %v", err)
+	}
+	if err := store.Release(ctx, "jobs", "req-1"); err != nil {
+		t.Fatalf("release: %v", err)
+	}
+	if resp, claimed, err := store.Claim(ctx, "jobs", "req-1"); err != nil || claimed || string(resp) != "first" {
+		t.Fatalf("claim after release: got %q, %v (%v), want the first response", resp, claimed, err)
+	}
+}
+
+func TestStoreReleaseDeletesClaim(t *testing.T) {
+	pool := newPool(t)
+	store := inbox.NewStore(pool, time.Hour)
+	ctx := t.Context()
+
+	if _, claimed, err := store.Claim(ctx, "jobs", "req-1"); err != nil || !claimed {
+		t.Fatalf("claim: got %v (%v), want claimed", claimed, err)
+	}
+	if err := store.Release(ctx, "jobs", "req-1"); err != nil {
+		t.Fatalf("release: %v", err)
+	}
+	if got := rows(t, pool, "req-1"); got != 0 {
+		t.Fatalf("rows after release: got %d, want 0", got)
+	}
+	if _, claimed, err := store.Claim(ctx, "jobs", "req-1"); err != nil || !claimed {
+		t.Fatalf("claim after release: got %v (%v), want claimed again", claimed, err)
+	}
+}
+
+func TestStoreClaimsOnce(t *testing.T) {
+	pool := newPool(t)
+	store := inbox.NewStore(pool, time.Hour)
+
+	var (
+		wg      sync.WaitGroup
+		claimed atomic.Int32
+	)
+	for range 8 {
+		wg.Go(func() {
+			_, ok, err := store.Claim(t.Context(), "jobs", "req-1")
+			if err != nil {
+				t.Errorf("claim: %v", err)
+			}
+			if ok {
+				claimed.Add(1)
+			}
+		})
+	}
+	wg.Wait()
+	if got := claimed.Load(); got != 1 {
+		t.Fatalf("concurrent claims: got %d claimed, want 1", got)
+	}
+}
+
+func TestStoreClaimTakesOverExpiredRows(t *testing.T) {
+	pool := newPool(t)
+	store := inbox.NewStore(pool, time.Hour)
+	store.SetClaimTTL(time.Minute)
+	ctx := t.Context()
+
+	// A claim whose handler never finished
+	if _, claimed, err := store.Claim(ctx, "jobs", "stale-claim"); err != nil || !claimed {
+		t.Fatalf("claim: got %v (%v), want claimed", claimed, err)
+	}
+	backdate(t, pool, "stale-claim", 2*time.Minute)
+	if _, claimed, err := store.Claim(ctx, "jobs", "stale-claim"); err != nil || !claimed {
+		t.Fatalf("claim over a stale claim: got %v (%v), want claimed", claimed, err)
+	}
+
+	// A response kept past the claim TTL is still live, past the TTL it is not
+	if err := store.Put(ctx, "jobs", "old-response", []byte("done")); err != nil {
+		t.Fatalf("put: %v", err)
+	}
+	backdate(t, pool, "old-response", 2*time.Minute)
+	if resp, claimed, err := store.Claim(ctx, "jobs", "old-response"); err != nil || claimed || string(resp) != "done" {
+		t.Fatalf("claim over a live response: got %q, %v (%v), want the response", resp, claimed, err)
+	}
+	backdate(t, pool, "old-response", 2*time.Hour)
+	if resp, claimed, err := store.Claim(ctx, "jobs", "old-response"); err != nil || !claimed || resp != nil {
+		t.Fatalf("claim over an expired response: got %q, %v (%v), want claimed", resp, claimed, err)
+	}
+}
+
+func TestStoreCleanup(t *testing.T) {
+	pool := newPool(t)
+	store := inbox.NewStore(pool, time.Hour)
+	ctx := t.Context()
+
+	for _, id := range []string{"expired", "live"} {
+		if err := store.Put(ctx, "jobs", id, []byte("done")); err != nil {
+			t.Fatalf("put %s: %v", id, err)
+		}
+	}
+	backdate(t, pool, "expired", 2*time.Hour)
+
+	if n, err := store.Cleanup(ctx); err != nil || n != 1 {
+		t.Fatalf("cleanup: got %d (%v), want 1", n, err)
+	}
+	if got := rows(t, pool, "live"); got != 1 {
+		t.Fatalf("live rows after cleanup: got %d, want 1", got)
+	}
+}
@@ -0,0 +1,201 @@
+package bus_test
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/PavelRadostev/toolkit/pkg/bus"
+)
+
+// popResult waits for the response to the request and decodes its data
+func popResult(t *testing.T, transport bus.Transport, requestID string) int {
+	t.Helper()
+
+	data, err := transport.PopResponse(t.Context(), requestID, 2*time.Second)
+	if err != nil || data == nil {
+		t.Fatalf("pop response: got %q (%v)", data, err)
+	}
+	resp, err := bus.DecodeTransportResponse(data)
+	if err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	var result int
+	if err := resp.Response().Decode(&result); err != nil {
+		t.Fatalf("decode result: %v", err)
+	}
+	return result
+}
+
+func TestInboxReplaysResponseToDuplicates(t *testing.T) {
+	transport := bus.NewMemoryTransport()
+	var calls atomic.Int32
+	factory := bus.NewHandlerFactory()
+	bus.Handle(factory, "jobs", func(ctx context.Context, j job) (int, error) {
+		return int(calls.Add(1)) * 10, nil
+	})
+
+	b := newBus(transport, factory)
+	b.Register("jobs", bus.WithInbox(bus.NewMemoryInbox(0)))
+	runBus(t, b, transport, bus.DefaultConsumerGroup, "jobs")
+
+	req, err := bus.NewRequest(job{Stream: "jobs", N: 1}, bus.WithReturnResult(true))
+	if err != nil {
+		t.Fatalf("new request: %v", err)
+	}
+	// The same request is delivered twice, e.g. sent again by a producer that timed out
+	for range 2 {
+		if err := b.EmitRequest(t.Context(), "jobs", req); err != nil {
+			t.Fatalf("emit request: %v", err)
+		}
+		if got := popResult(t, transport, req.RequestID); got != 10 {
+			t.Fatalf("response: got %d, want the first result 10", got)
+		}
+	}
+	if got := calls.Load(); got != 1 {
+		t.Fatalf("handler calls: got %d, want 1", got)
+	}
+}
+
+func TestInboxHandlesConcurrentDuplicatesOnce(t *testing.T) {
+	transport := bus.NewMemoryTransport()
+	var calls atomic.Int32
+	factory := bus.NewHandlerFactory()
+	bus.Handle(factory, "jobs", func(ctx context.Context, j job) (int, error) {
+		n := calls.Add(1)
+		// Keeps the first delivery running while the duplicates are read
+		time.Sleep(50 * time.Millisecond)
+		return int(n) * 10, nil
+	})
+
+	b := newBus(transport, factory)
+	b.SetClaimPolicy(bus.ClaimPolicy{Interval: 10 * time.Millisecond, MinIdle: 20 * time.Millisecond})
+	b.Register("jobs", bus.WithInbox(bus.NewMemoryInbox(0)), bus.WithWorkers(4))
+	runBus(t, b, transport, bus.DefaultConsumerGroup, "jobs")
+
+	req, err := bus.NewRequest(job{Stream: "jobs", N: 1}, bus.WithReturnResult(true))
+	if err != nil {
+		t.Fatalf("new request: %v", err)
+	}
+	for range 3 {
+		if err := b.EmitRequest(t.Context(), "jobs", req); err != nil {
+			t.Fatalf("emit request: %v", err)
+		}
+	}
+
+	// The duplicates left pending while the first delivery runs are reclaimed later
+	// and answered with the stored response
+	for range 3 {
+		if got := popResult(t, transport, req.RequestID); got != 10 {
+			t.Fatalf("response: got %d, want 10", got)
+		}
+	}
+	if got := calls.Load(); got != 1 {
+		t.Fatalf("handler calls: got %d, want 1", got)
+	}
+}
+
+func TestInboxReleasesClaimOfFailedRequest(t *testing.T) {
+	transport := bus.NewMemoryTransport()
+	var calls atomic.Int32
+	factory := bus.NewHandlerFactory()
+	bus.Handle(factory, "jobs", func(ctx context.Context, j job) (int, error) {
+		if calls.Add(1) == 1 {
+			return 0, bus.ErrNotFound
+		}
+		return 1, nil
+	})
+
+	b := newBus(transport, factory)
+	b.Register("jobs", bus.WithInbox(bus.NewMemoryInbox(0)))
+	runBus(t, b, transport, bus.DefaultConsumerGroup, "jobs")
+
+	req, err := bus.NewRequest(job{Stream: "jobs", N: 1})
+	if err != nil {
+		t.Fatalf("new request: %v", err)
+	}
+	for range 2 {
+		if err := b.EmitRequest(t.Context(), "jobs", req); err != nil {
+			t.Fatalf("emit request: %v", err)
+		}
+	}
+	eventually(t, time.Second, func() bool { return calls.Load() == 2 })
+}
+
+// forEachInbox runs the test against a MemoryInbox and a RedisInbox with the given TTLs
+func forEachInbox(t *testing.T, ttl, claimTTL time.Duration, test func(t *testing.T, inbox bus.Inbox)) {
+	t.Run("memory", func(t *testing.T) {
+		inbox := bus.NewMemoryInbox(ttl)
+		inbox.SetClaimTTL(claimTTL)
+		test(t, inbox)
+	})
+	t.Run("redis", func(t *testing.T) {
+		client, _ := newRedis(t)
+		inbox := bus.NewRedisInbox(client, ttl)
+		inbox.SetClaimTTL(claimTTL)
+		test(t, inbox)
+	})
+}
+
+func TestInboxClaim(t *testing.T) {
+	forEachInbox(t, time.Minute, time.Minute, func(t *testing.T, inbox bus.Inbox) {
+		ctx := t.Context()
+		if _, claimed, err := inbox.Claim(ctx, "jobs", "req-1"); err != nil || !claimed {
+			t.Fatalf("first claim: got %v (%v), want claimed", claimed, err)
+		}
+		if data, claimed, err := inbox.Claim(ctx, "jobs", "req-1"); err != nil || claimed || data != nil {
+			t.Fatalf("claim while handled: got %q %v (%v), want busy", data, claimed, err)
+		}
+		if _, claimed, _ := inbox.Claim(ctx, "other", "req-1"); !claimed {
+			t.Fatal("request IDs of another stream must not match")
+		}
+
+		if err := inbox.Put(ctx, "jobs", "req-1", []byte("resp")); err != nil {
+			t.Fatalf("put: %v", err)
+		}
+		if err := inbox.Release(ctx, "jobs", "req-1"); err != nil {
+			t.Fatalf("release after put: %v", err)
+		}
+		if data, claimed, err := inbox.Claim(ctx, "jobs", "req-1"); err != nil || claimed || string(data) != "resp" {
+			t.Fatalf("claim a processed request: got %q %v (%v), want the stored response", data, claimed, err)
+		}
+	})
+}
+
+func TestInboxRelease(t *testing.T) {
+	forEachInbox(t, time.Minute, time.Minute, func(t *testing.T, inbox bus.Inbox) {
+		ctx := t.Context()
+		if _, claimed, err := inbox.Claim(ctx, "jobs", "req-1"); err != nil || !claimed {
+			t.Fatalf("claim: got %v (%v), want claimed", claimed, err)
+		}
+		if err := inbox.Release(ctx, "jobs", "req-1"); err != nil {
+			t.Fatalf("release: %v", err)
+		}
+		if _, claimed, err := inbox.Claim(ctx, "jobs", "req-1"); err != nil || !claimed {
+			t.Fatalf("claim after release: got %v (%v), want claimed", claimed, err)
+		}
+	})
+}
+
+func TestMemoryInboxExpires(t *testing.T) {
+	inbox := bus.NewMemoryInbox(10 * time.Millisecond)
+	inbox.SetClaimTTL(10 * time.Millisecond)
+	ctx := t.Context()
+
+	// A claim whose consumer died expires
+	inbox.Claim(ctx, "jobs", "req-1")
+	time.Sleep(20 * time.Millisecond)
+	if _, claimed, err := inbox.Claim(ctx, "jobs", "req-1"); err != nil || !claimed {
+		t.Fatalf("claim after the claim expired: got %v (%v), want claimed", claimed, err)
+	}
+
+	// A stored response expires after the TTL
+	if err := inbox.Put(ctx, "jobs", "req-1", []byte("resp")); err != nil {
+		t.Fatalf("put: %v", err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if _, claimed, err := inbox.Claim(ctx, "jobs", "req-1"); err != nil || !claimed {
+		t.Fatalf("claim after the response expired: got %v (%v), want claimed", claimed, err)
+	}
+}
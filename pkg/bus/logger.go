@@ -0,0 +1,72 @@
+package bus
+
+import (
+	"context"
+	"log/slog"
+)
+
+// Attribute keys used in bus log records
+const (
+	LogKeyStream         = "stream"
+	LogKeyRequestID      = "request_id"
+	LogKeyRedisMessageID = "redis_message_id"
+	LogKeyAttempt        = "attempt"
+	LogKeyDuration       = "duration"
+	LogKeyError          = "error"
+)
+
+// SetLogger sets the logger of the Bus, nil means slog.Default()
+// Per-message records go to the Debug level, failures to Warn and Error
+func (b *Bus) SetLogger(logger *slog.Logger) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.logger = logger
+}
+
+// log returns the configured logger
+func (b *Bus) log() *slog.Logger {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return orDefault(b.logger)
+}
+
+// SetLogger sets the logger of the factory, nil means slog.Default()
+func (f *HandlerFactory) SetLogger(logger *slog.Logger) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.logger = logger
+}
+
+// log returns the configured logger, the caller holds f.mu
+func (f *HandlerFactory) log() *slog.Logger {
+	return orDefault(f.logger)
+}
+
+// orDefault resolves a nil logger to slog.Default() at call time, so slog.SetDefault applies later on
+func orDefault(logger *slog.Logger) *slog.Logger {
+	if logger == nil {
+		return slog.Default()
+	}
+	return logger
+}
+
+type loggerKey struct{}
+
+// ContextWithLogger returns a context carrying the logger
+func ContextWithLogger(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, logger)
+}
+
+// LoggerFromContext returns the logger stored in ctx, slog.Default() when there is none
+// Handlers get the bus logger with the stream, request_id and redis_message_id of the message
+func LoggerFromContext(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(loggerKey{}).(*slog.Logger); ok {
+		return logger
+	}
+	return slog.Default()
+}
+
+// requestLogger returns the logger with the attributes identifying a consumed message
+func requestLogger(logger *slog.Logger, streamName string, req *TransportRequest) *slog.Logger {
+	return logger.With(LogKeyStream, streamName, LogKeyRequestID, req.RequestID, LogKeyRedisMessageID, req.RedisMessageID)
+}
@@ -0,0 +1,80 @@
+package bus_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/PavelRadostev/toolkit/pkg/bus"
+)
+
+// logBuffer collects JSON log records written from several goroutines
+type logBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *logBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+// records decodes the collected records with the given message
+func (b *logBuffer) records(t *testing.T, msg string) []map[string]any {
+	t.Helper()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var records []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(b.buf.String()), "\n") {
+		var record map[string]any
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("decode log record %q: %v", line, err)
+		}
+		if record[slog.MessageKey] == msg {
+			records = append(records, record)
+		}
+	}
+	return records
+}
+
+func TestHandlerLoggerCarriesMessageAttributes(t *testing.T) {
+	transport := bus.NewMemoryTransport()
+	factory := bus.NewHandlerFactory()
+	bus.Handle(factory, "jobs", func(ctx context.Context, j job) (int, error) {
+		bus.LoggerFromContext(ctx).Info("inside handler")
+		return j.N, nil
+	})
+
+	var logs logBuffer
+	b := newBus(transport, factory)
+	b.SetLogger(slog.New(slog.NewJSONHandler(&logs, nil)))
+	b.Use(bus.Logging())
+	b.UsePublish(bus.PublishLogging())
+	b.Register("jobs")
+	runBus(t, b, transport, bus.DefaultConsumerGroup, "jobs")
+
+	if _, err := bus.Call[job, int](t.Context(), b, job{Stream: "jobs", N: 1}); err != nil {
+		t.Fatalf("call: %v", err)
+	}
+
+	for _, msg := range []string{"inside handler", "Handled message"} {
+		records := logs.records(t, msg)
+		if len(records) != 1 {
+			t.Fatalf("%q records: got %d, want 1", msg, len(records))
+		}
+		for _, key := range []string{bus.LogKeyStream, bus.LogKeyRequestID, bus.LogKeyRedisMessageID} {
+			if value, _ := records[0][key].(string); value == "" {
+				t.Fatalf("%q record has no %s: %v", msg, key, records[0])
+			}
+		}
+	}
+	if records := logs.records(t, "Published message"); len(records) != 1 || records[0][bus.LogKeyStream] != "jobs" {
+		t.Fatalf("publish records: got %v", records)
+	}
+}
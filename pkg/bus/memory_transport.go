@@ -0,0 +1,679 @@
+package bus
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemoryTransport implements Transport in process memory
+// It supports streams, consumer groups with pending entries, response lists and expiry,
+// so handlers can be run and tested end-to-end without Redis
+type MemoryTransport struct {
+	mu      sync.Mutex
+	streams map[string]*memoryStream
+	lists   map[string]*memoryList
+	// scheduled entries ordered by due time
+	scheduled []memoryScheduled
+	// cancelled requests with the expiry of their marker
+	cancelled map[string]time.Time
+	// watchers receive IDs of cancelled requests
+	watchers map[*memoryWatcher]struct{}
+	// changed is closed and replaced on every write to wake up blocked readers
+	changed chan struct{}
+}
+
+// streamID is a parsed "<ms>-<seq>" stream entry ID
+type streamID struct {
+	ms  uint64
+	seq uint64
+}
+
+// memoryStream is a single stream with its consumer groups
+type memoryStream struct {
+	entries []memoryEntry
+	last    streamID
+	groups  map[string]*memoryGroup
+}
+
+// memoryEntry is a stored stream entry
+type memoryEntry struct {
+	id     streamID
+	values map[string]interface{}
+}
+
+// memoryGroup is a consumer group with its pending entries list
+type memoryGroup struct {
+	lastDelivered streamID
+	pending       map[streamID]*memoryPending
+}
+
+// memoryPending describes an entry delivered to a consumer but not acknowledged
+type memoryPending struct {
+	consumer    string
+	deliveredAt time.Time
+}
+
+// memoryList is a response list with its expiry
+type memoryList struct {
+	items     [][]byte
+	expiresAt time.Time
+}
+
+// memoryScheduled is an entry parked until its due time
+type memoryScheduled struct {
+	at     time.Time
+	stream string
+	values map[string]interface{}
+	maxLen int64
+}
+
+// memoryWatcher is a WatchCancellations subscriber
+type memoryWatcher struct {
+	ids  chan string
+	done <-chan struct{}
+}
+
+// NewMemoryTransport creates an empty in-memory transport
+func NewMemoryTransport() *MemoryTransport {
+	return &MemoryTransport{
+		streams:   make(map[string]*memoryStream),
+		lists:     make(map[string]*memoryList),
+		cancelled: make(map[string]time.Time),
+		watchers:  make(map[*memoryWatcher]struct{}),
+		changed:   make(chan struct{}),
+	}
+}
+
+// Add appends an entry to the stream, keeping at most maxLen entries when it is set
+// Values are stored as strings, the way Redis returns them
+func (t *MemoryTransport) Add(ctx context.Context, stream string, values map[string]interface{}, maxLen int64) (string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	s := t.stream(stream)
+	id := s.nextID(time.Now())
+	s.entries = append(s.entries, memoryEntry{id: id, values: normalizeValues(values)})
+	s.last = id
+	if maxLen > 0 && int64(len(s.entries)) > maxLen {
+		s.entries = slices.Delete(s.entries, 0, len(s.entries)-int(maxLen))
+	}
+
+	t.notify()
+	return id.String(), nil
+}
+
+// Delete removes entries from the stream, pending references stay like in Redis
+func (t *MemoryTransport) Delete(ctx context.Context, stream string, ids ...string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	s, ok := t.streams[stream]
+	if !ok {
+		return nil
+	}
+	for _, raw := range ids {
+		id, err := parseStreamID(raw)
+		if err != nil {
+			return err
+		}
+		s.entries = slices.DeleteFunc(s.entries, func(e memoryEntry) bool { return e.id == id })
+	}
+	return nil
+}
+
+// Trim removes entries with IDs lower than minID
+func (t *MemoryTransport) Trim(ctx context.Context, stream, minID string) (int64, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	floor, err := parseStreamID(minID)
+	if err != nil {
+		return 0, err
+	}
+	s, ok := t.streams[stream]
+	if !ok {
+		return 0, nil
+	}
+	before := len(s.entries)
+	s.entries = slices.DeleteFunc(s.entries, func(e memoryEntry) bool { return e.id.less(floor) })
+	return int64(before - len(s.entries)), nil
+}
+
+// TrimFloor returns the lowest entry ID still needed by a consumer group of the stream
+func (t *MemoryTransport) TrimFloor(ctx context.Context, stream string) (string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	s, ok := t.streams[stream]
+	if !ok || len(s.groups) == 0 {
+		return "", nil
+	}
+
+	var floor *streamID
+	for _, g := range s.groups {
+		id := g.lastDelivered
+		for pendingID := range g.pending {
+			if pendingID.less(id) {
+				id = pendingID
+			}
+		}
+		if floor == nil || id.less(*floor) {
+			floor = &id
+		}
+	}
+	return floor.String(), nil
+}
+
+// Read reads entries after the given ID, blocking up to block
+func (t *MemoryTransport) Read(ctx context.Context, stream, after string, count int, block time.Duration) ([]Entry, error) {
+	from, err := parseStreamID(after)
+	if err != nil {
+		return nil, err
+	}
+
+	deadline := time.Now().Add(block)
+	for {
+		t.mu.Lock()
+		var entries []Entry
+		if s, ok := t.streams[stream]; ok {
+			for _, e := range s.entries {
+				if count > 0 && len(entries) >= count {
+					break
+				}
+				if from.less(e.id) {
+					entries = append(entries, e.entry())
+				}
+			}
+		}
+		changed := t.changed
+		t.mu.Unlock()
+
+		if len(entries) > 0 {
+			return entries, nil
+		}
+		if !waitChanged(ctx, changed, deadline) {
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// LastID returns the ID of the last entry added to the stream
+func (t *MemoryTransport) LastID(ctx context.Context, stream string) (string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	s, ok := t.streams[stream]
+	if !ok {
+		return "0-0", nil
+	}
+	return s.last.String(), nil
+}
+
+// CreateGroup creates the consumer group and the stream if they do not exist
+func (t *MemoryTransport) CreateGroup(ctx context.Context, stream, group, start string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	s := t.stream(stream)
+	if _, ok := s.groups[group]; ok {
+		return nil
+	}
+
+	lastDelivered := s.last
+	if start != "$" {
+		id, err := parseStreamID(start)
+		if err != nil {
+			return err
+		}
+		lastDelivered = id
+	}
+
+	s.groups[group] = &memoryGroup{
+		lastDelivered: lastDelivered,
+		pending:       make(map[streamID]*memoryPending),
+	}
+	return nil
+}
+
+// ReadGroup reads entries not yet delivered to the group, blocking up to block
+func (t *MemoryTransport) ReadGroup(ctx context.Context, stream, group, consumer string, count int, block time.Duration) ([]Entry, error) {
+	deadline := time.Now().Add(block)
+	for {
+		t.mu.Lock()
+		entries, err := t.readGroup(stream, group, consumer, count)
+		changed := t.changed
+		t.mu.Unlock()
+
+		if err != nil || len(entries) > 0 {
+			return entries, err
+		}
+		if !waitChanged(ctx, changed, deadline) {
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// readGroup delivers new entries to the consumer, the caller holds the lock
+func (t *MemoryTransport) readGroup(stream, group, consumer string, count int) ([]Entry, error) {
+	s, g, err := t.group(stream, group)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	var entries []Entry
+	for _, e := range s.entries {
+		if count > 0 && len(entries) >= count {
+			break
+		}
+		if !g.lastDelivered.less(e.id) {
+			continue
+		}
+		g.lastDelivered = e.id
+		g.pending[e.id] = &memoryPending{consumer: consumer, deliveredAt: now}
+		entries = append(entries, e.entry())
+	}
+	return entries, nil
+}
+
+// GroupLag counts entries added after the last entry delivered to the group
+func (t *MemoryTransport) GroupLag(ctx context.Context, stream, group string) (int64, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	s, g, err := t.group(stream, group)
+	if err != nil {
+		return -1, err
+	}
+	var lag int64
+	for _, e := range s.entries {
+		if g.lastDelivered.less(e.id) {
+			lag++
+		}
+	}
+	return lag, nil
+}
+
+// Ack removes entries from the pending entries list of the group
+func (t *MemoryTransport) Ack(ctx context.Context, stream, group string, ids ...string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	_, g, err := t.group(stream, group)
+	if err != nil {
+		return err
+	}
+	for _, raw := range ids {
+		id, err := parseStreamID(raw)
+		if err != nil {
+			return err
+		}
+		delete(g.pending, id)
+	}
+	return nil
+}
+
+// Claim transfers pending entries idle for at least minIdle to the consumer
+// Pending references to deleted entries are dropped, like XAUTOCLAIM in Redis 7
+func (t *MemoryTransport) Claim(ctx context.Context, stream, group, consumer string, minIdle time.Duration, start string, count int) ([]Entry, string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	s, g, err := t.group(stream, group)
+	if err != nil {
+		return nil, "", err
+	}
+	from, err := parseStreamID(start)
+	if err != nil {
+		return nil, "", err
+	}
+
+	ids := make([]streamID, 0, len(g.pending))
+	for id := range g.pending {
+		if !id.less(from) {
+			ids = append(ids, id)
+		}
+	}
+	slices.SortFunc(ids, compareStreamID)
+
+	now := time.Now()
+	var entries []Entry
+	for i, id := range ids {
+		if count > 0 && len(entries) >= count {
+			return entries, ids[i].String(), nil
+		}
+
+		idx := slices.IndexFunc(s.entries, func(e memoryEntry) bool { return e.id == id })
+		if idx < 0 {
+			delete(g.pending, id)
+			continue
+		}
+
+		p := g.pending[id]
+		if now.Sub(p.deliveredAt) < minIdle {
+			continue
+		}
+		p.consumer = consumer
+		p.deliveredAt = now
+		entries = append(entries, s.entries[idx].entry())
+	}
+	return entries, "0-0", nil
+}
+
+// Touch resets the idle time of pending entries and assigns them to the consumer
+func (t *MemoryTransport) Touch(ctx context.Context, stream, group, consumer string, ids ...string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	_, g, err := t.group(stream, group)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	for _, raw := range ids {
+		id, err := parseStreamID(raw)
+		if err != nil {
+			return err
+		}
+		if p, ok := g.pending[id]; ok {
+			p.consumer = consumer
+			p.deliveredAt = now
+		}
+	}
+	return nil
+}
+
+// PushResponse appends a response to the list and sets the list expiry
+func (t *MemoryTransport) PushResponse(ctx context.Context, key string, data []byte, ttl time.Duration) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.expireLists()
+	l, ok := t.lists[key]
+	if !ok {
+		l = &memoryList{}
+		t.lists[key] = l
+	}
+	l.items = append(l.items, slices.Clone(data))
+	l.expiresAt = time.Now().Add(ttl)
+
+	t.notify()
+	return nil
+}
+
+// PopResponse removes the first response from the list, blocking up to timeout
+func (t *MemoryTransport) PopResponse(ctx context.Context, key string, timeout time.Duration) ([]byte, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		t.mu.Lock()
+		data := t.popResponse(key)
+		changed := t.changed
+		t.mu.Unlock()
+
+		if data != nil {
+			return data, nil
+		}
+		if !waitChanged(ctx, changed, deadline) {
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// popResponse removes the first response from a live list, the caller holds the lock
+func (t *MemoryTransport) popResponse(key string) []byte {
+	l, ok := t.lists[key]
+	if !ok {
+		return nil
+	}
+	if time.Now().After(l.expiresAt) {
+		delete(t.lists, key)
+		return nil
+	}
+
+	data := l.items[0]
+	l.items = l.items[1:]
+	if len(l.items) == 0 {
+		delete(t.lists, key)
+	}
+	return data
+}
+
+// expireLists drops expired response lists, the caller holds the lock
+func (t *MemoryTransport) expireLists() {
+	now := time.Now()
+	for key, l := range t.lists {
+		if now.After(l.expiresAt) {
+			delete(t.lists, key)
+		}
+	}
+}
+
+// CancelRequest records the marker of the request and hands its ID to every watcher
+func (t *MemoryTransport) CancelRequest(ctx context.Context, requestID string, ttl time.Duration) error {
+	t.mu.Lock()
+	now := time.Now()
+	for id, expiresAt := range t.cancelled {
+		if !now.Before(expiresAt) {
+			delete(t.cancelled, id)
+		}
+	}
+	t.cancelled[requestID] = now.Add(ttl)
+	watchers := slices.Collect(maps.Keys(t.watchers))
+	t.mu.Unlock()
+
+	for _, w := range watchers {
+		select {
+		case w.ids <- requestID:
+		case <-w.done:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// RequestCancelled checks the marker of the request
+func (t *MemoryTransport) RequestCancelled(_ context.Context, requestID string) (bool, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	expiresAt, ok := t.cancelled[requestID]
+	return ok && time.Now().Before(expiresAt), nil
+}
+
+// WatchCancellations registers a watcher until ctx is done
+// The channel is never closed, a send racing with ctx would otherwise panic
+func (t *MemoryTransport) WatchCancellations(ctx context.Context) (<-chan string, error) {
+	w := &memoryWatcher{ids: make(chan string, 16), done: ctx.Done()}
+
+	t.mu.Lock()
+	t.watchers[w] = struct{}{}
+	t.mu.Unlock()
+
+	context.AfterFunc(ctx, func() {
+		t.mu.Lock()
+		delete(t.watchers, w)
+		t.mu.Unlock()
+	})
+	return w.ids, nil
+}
+
+// Schedule parks the entry until at
+func (t *MemoryTransport) Schedule(ctx context.Context, stream string, values map[string]interface{}, at time.Time, maxLen int64) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	// Keep the order by due time, entries due at the same time keep the scheduling order
+	i := sort.Search(len(t.scheduled), func(i int) bool { return t.scheduled[i].at.After(at) })
+	t.scheduled = slices.Insert(t.scheduled, i, memoryScheduled{at: at, stream: stream, values: normalizeValues(values), maxLen: maxLen})
+	return nil
+}
+
+// MoveDue appends up to count due entries to their streams, nothing is ever parked
+func (t *MemoryTransport) MoveDue(ctx context.Context, now time.Time, count int) (int, int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	moved := 0
+	for moved < len(t.scheduled) && moved < count && !t.scheduled[moved].at.After(now) {
+		item := t.scheduled[moved]
+		s := t.stream(item.stream)
+		id := s.nextID(time.Now())
+		s.entries = append(s.entries, memoryEntry{id: id, values: item.values})
+		s.last = id
+		if item.maxLen > 0 && int64(len(s.entries)) > item.maxLen {
+			s.entries = slices.Delete(s.entries, 0, len(s.entries)-int(item.maxLen))
+		}
+		moved++
+	}
+	if moved > 0 {
+		t.scheduled = slices.Delete(t.scheduled, 0, moved)
+		t.notify()
+	}
+	return moved, 0, nil
+}
+
+// stream returns the stream, creating it when missing, the caller holds the lock
+func (t *MemoryTransport) stream(name string) *memoryStream {
+	s, ok := t.streams[name]
+	if !ok {
+		s = &memoryStream{groups: make(map[string]*memoryGroup)}
+		t.streams[name] = s
+	}
+	return s
+}
+
+// group returns the stream and its consumer group, the caller holds the lock
+func (t *MemoryTransport) group(stream, group string) (*memoryStream, *memoryGroup, error) {
+	s, ok := t.streams[stream]
+	if !ok {
+		return nil, nil, fmt.Errorf("NOGROUP no such key %q or consumer group %q", stream, group)
+	}
+	g, ok := s.groups[group]
+	if !ok {
+		return nil, nil, fmt.Errorf("NOGROUP no such key %q or consumer group %q", stream, group)
+	}
+	return s, g, nil
+}
+
+// notify wakes up blocked readers, the caller holds the lock
+func (t *MemoryTransport) notify() {
+	close(t.changed)
+	t.changed = make(chan struct{})
+}
+
+// waitChanged waits for a write, the deadline or context cancellation
+// Returns false when the caller should stop waiting
+func waitChanged(ctx context.Context, changed <-chan struct{}, deadline time.Time) bool {
+	remaining := time.Until(deadline)
+	if remaining <= 0 {
+		return false
+	}
+
+	timer := time.NewTimer(remaining)
+	defer timer.Stop()
+
+	select {
+	case <-changed:
+		return true
+	case <-timer.C:
+		return false
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// nextID returns an ID greater than the last one, based on the current time
+func (s *memoryStream) nextID(now time.Time) streamID {
+	ms := uint64(now.UnixMilli())
+	if ms > s.last.ms {
+		return streamID{ms: ms}
+	}
+	return streamID{ms: s.last.ms, seq: s.last.seq + 1}
+}
+
+// entry returns a copy of the stored entry
+func (e memoryEntry) entry() Entry {
+	values := make(map[string]interface{}, len(e.values))
+	for k, v := range e.values {
+		values[k] = v
+	}
+	return Entry{ID: e.id.String(), Values: values}
+}
+
+// normalizeValues converts values to strings the way Redis stores them
+func normalizeValues(values map[string]interface{}) map[string]interface{} {
+	normalized := make(map[string]interface{}, len(values))
+	for k, v := range values {
+		switch val := v.(type) {
+		case string:
+			normalized[k] = val
+		case []byte:
+			normalized[k] = string(val)
+		default:
+			normalized[k] = fmt.Sprint(val)
+		}
+	}
+	return normalized
+}
+
+// parseStreamID parses "<ms>-<seq>" or "<ms>"
+func parseStreamID(raw string) (streamID, error) {
+	msPart, seqPart, hasSeq := strings.Cut(raw, "-")
+	ms, err := strconv.ParseUint(msPart, 10, 64)
+	if err != nil {
+		return streamID{}, fmt.Errorf("invalid stream ID %q", raw)
+	}
+	var seq uint64
+	if hasSeq {
+		seq, err = strconv.ParseUint(seqPart, 10, 64)
+		if err != nil {
+			return streamID{}, fmt.Errorf("invalid stream ID %q", raw)
+		}
+	}
+	return streamID{ms: ms, seq: seq}, nil
+}
+
+// String formats the ID as "<ms>-<seq>"
+func (id streamID) String() string {
+	return strconv.FormatUint(id.ms, 10) + "-" + strconv.FormatUint(id.seq, 10)
+}
+
+// less reports whether the ID sorts before the other one
+func (id streamID) less(other streamID) bool {
+	return compareStreamID(id, other) < 0
+}
+
+// minStreamID returns the lower of two "<ms>-<seq>" IDs, an empty ID counts as unset
+func minStreamID(a, b string) (string, error) {
+	if a == "" || b == "" {
+		return a + b, nil
+	}
+	idA, err := parseStreamID(a)
+	if err != nil {
+		return "", err
+	}
+	idB, err := parseStreamID(b)
+	if err != nil {
+		return "", err
+	}
+	if idB.less(idA) {
+		return b, nil
+	}
+	return a, nil
+}
+
+// compareStreamID orders IDs by time and sequence
+func compareStreamID(a, b streamID) int {
+	if c := cmp.Compare(a.ms, b.ms); c != 0 {
+		return c
+	}
+	return cmp.Compare(a.seq, b.seq)
+}
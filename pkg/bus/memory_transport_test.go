@@ -0,0 +1,161 @@
+package bus_test
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/PavelRadostev/toolkit/pkg/bus"
+)
+
+func TestMemoryTransportAddTrimsToMaxLen(t *testing.T) {
+	transport := bus.NewMemoryTransport()
+
+	var ids []string
+	for i := range 5 {
+		id, err := transport.Add(t.Context(), "s", map[string]interface{}{"n": i}, 3)
+		if err != nil {
+			t.Fatalf("add: %v", err)
+		}
+		ids = append(ids, id)
+	}
+	entries, err := transport.Read(t.Context(), "s", "0-0", 10, 0)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if got := entryIDs(entries); !slices.Equal(got, ids[2:]) {
+		t.Fatalf("entries: got %v, want the last three %v", got, ids[2:])
+	}
+}
+
+func TestMemoryTransportGroupLag(t *testing.T) {
+	transport := bus.NewMemoryTransport()
+	ctx := t.Context()
+
+	if _, err := transport.GroupLag(ctx, "s", "g"); err == nil {
+		t.Fatal("lag of a missing group: expected an error")
+	}
+	if err := transport.CreateGroup(ctx, "s", "g", "$"); err != nil {
+		t.Fatalf("create group: %v", err)
+	}
+	addEntries(t, transport, "s", 4)
+	if _, err := transport.ReadGroup(ctx, "s", "g", "c", 1, 0); err != nil {
+		t.Fatalf("read group: %v", err)
+	}
+	if lag, err := transport.GroupLag(ctx, "s", "g"); err != nil || lag != 3 {
+		t.Fatalf("lag: got %d (%v), want 3", lag, err)
+	}
+}
+
+func TestMemoryTransportClaimDropsDeletedEntries(t *testing.T) {
+	transport := bus.NewMemoryTransport()
+	ctx := t.Context()
+
+	if err := transport.CreateGroup(ctx, "s", "g", "$"); err != nil {
+		t.Fatalf("create group: %v", err)
+	}
+	ids := addEntries(t, transport, "s", 2)
+	if _, err := transport.ReadGroup(ctx, "s", "g", "c", 2, 0); err != nil {
+		t.Fatalf("read group: %v", err)
+	}
+	if err := transport.Delete(ctx, "s", ids[0]); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+
+	entries, _, err := transport.Claim(ctx, "s", "g", "other", 0, "0-0", 10)
+	if err != nil {
+		t.Fatalf("claim: %v", err)
+	}
+	if got := entryIDs(entries); !slices.Equal(got, ids[1:]) {
+		t.Fatalf("claimed: got %v, want %v", got, ids[1:])
+	}
+	if got := pendingIDs(t, transport, "s", "g"); !slices.Equal(got, ids[1:]) {
+		t.Fatalf("pending: got %v, want the deleted entry dropped", got)
+	}
+}
+
+func TestMemoryTransportPopWaitsForPush(t *testing.T) {
+	transport := bus.NewMemoryTransport()
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		transport.PushResponse(context.Background(), "resp", []byte("done"), time.Minute)
+	}()
+	data, err := transport.PopResponse(t.Context(), "resp", 2*time.Second)
+	if err != nil || string(data) != "done" {
+		t.Fatalf("pop: got %q (%v), want the pushed response", data, err)
+	}
+}
+
+func TestMemoryTransportPopStopsWithContext(t *testing.T) {
+	transport := bus.NewMemoryTransport()
+
+	ctx, cancel := context.WithTimeout(t.Context(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := transport.PopResponse(ctx, "resp", time.Minute); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("pop: got %v, want the context error", err)
+	}
+}
+
+func TestMemoryTransportResponsesExpire(t *testing.T) {
+	transport := bus.NewMemoryTransport()
+
+	if err := transport.PushResponse(t.Context(), "resp", []byte("late"), 10*time.Millisecond); err != nil {
+		t.Fatalf("push: %v", err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if data, err := transport.PopResponse(t.Context(), "resp", 10*time.Millisecond); err != nil || data != nil {
+		t.Fatalf("pop an expired response: got %q (%v), want none", data, err)
+	}
+}
+
+func TestMemoryTransportCancellationsExpire(t *testing.T) {
+	transport := bus.NewMemoryTransport()
+
+	if err := transport.CancelRequest(t.Context(), "req-1", 10*time.Millisecond); err != nil {
+		t.Fatalf("cancel: %v", err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if ok, err := transport.RequestCancelled(t.Context(), "req-1"); err != nil || ok {
+		t.Fatalf("expired marker: got %v (%v), want false", ok, err)
+	}
+}
+
+func TestMemoryTransportMoveDueKeepsOrder(t *testing.T) {
+	transport := bus.NewMemoryTransport()
+	ctx := t.Context()
+	now := time.Now()
+
+	for _, item := range []struct {
+		name string
+		at   time.Time
+	}{
+		{"second", now.Add(-time.Second)},
+		{"first", now.Add(-time.Minute)},
+		{"third", now.Add(-time.Second)},
+	} {
+		if err := transport.Schedule(ctx, "s", map[string]interface{}{"name": item.name}, item.at, 0); err != nil {
+			t.Fatalf("schedule: %v", err)
+		}
+	}
+	if moved, _, err := transport.MoveDue(ctx, now, 2); err != nil || moved != 2 {
+		t.Fatalf("move due: got %d (%v), want 2 limited by count", moved, err)
+	}
+	if moved, _, err := transport.MoveDue(ctx, now, 2); err != nil || moved != 1 {
+		t.Fatalf("move the rest: got %d (%v), want 1", moved, err)
+	}
+
+	entries, err := transport.Read(ctx, "s", "0-0", 10, 0)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Values["name"].(string))
+	}
+	if want := []string{"first", "second", "third"}; !slices.Equal(names, want) {
+		t.Fatalf("moved order: got %v, want %v", names, want)
+	}
+}
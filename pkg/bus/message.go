@@ -0,0 +1,72 @@
+package bus
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+// MessageInfo describes the class of a message, sent CBOR-encoded in the "m" field
+// Python consumers use it to pick the class the properties are deserialized into
+type MessageInfo struct {
+	// Class name, e.g. "AllGGISImportTemplatesQuery"
+	Name string `cbor:"name,omitempty"`
+	// Module the class lives in, e.g. "ggis.queries"
+	Module string `cbor:"module,omitempty"`
+	// Schema version of the properties, 0 when not versioned
+	Version int `cbor:"version,omitempty"`
+}
+
+// IsZero returns true when no class metadata is set
+func (i MessageInfo) IsZero() bool {
+	return i == MessageInfo{}
+}
+
+// Describer is an optional Publisher extension that supplies message class metadata
+type Describer interface {
+	MessageInfo() MessageInfo
+}
+
+// EncodeMessageInfo encodes the class metadata of a value implementing Describer for the "m" field
+// Values without metadata get an empty CBOR map
+func EncodeMessageInfo(value any) ([]byte, error) {
+	describer, ok := value.(Describer)
+	if !ok {
+		return []byte{0xa0}, nil // Empty CBOR map
+	}
+	info := describer.MessageInfo()
+	if info.IsZero() {
+		return []byte{0xa0}, nil // Empty CBOR map
+	}
+	data, err := cbor.Marshal(info)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode message info: %w", err)
+	}
+	return data, nil
+}
+
+// MessageInfo decodes the class metadata from the Message field
+// Unknown keys sent by other producers are ignored
+func (r *TransportRequest) MessageInfo() (MessageInfo, error) {
+	var info MessageInfo
+	if err := r.DecodeMessage(&info); err != nil {
+		return MessageInfo{}, fmt.Errorf("failed to decode message info: %w", err)
+	}
+	return info, nil
+}
+
+// messageInfoKey is the context key of the handled message class metadata
+type messageInfoKey struct{}
+
+// ContextWithMessageInfo returns a copy of ctx carrying the message class metadata
+func ContextWithMessageInfo(ctx context.Context, info MessageInfo) context.Context {
+	return context.WithValue(ctx, messageInfoKey{}, info)
+}
+
+// MessageInfoFromContext returns the class metadata of the message being handled
+// Returns false when the producer did not send any
+func MessageInfoFromContext(ctx context.Context) (MessageInfo, bool) {
+	info, ok := ctx.Value(messageInfoKey{}).(MessageInfo)
+	return info, ok && !info.IsZero()
+}
@@ -0,0 +1,47 @@
+package bus_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/PavelRadostev/toolkit/pkg/bus"
+	"github.com/PavelRadostev/toolkit/pkg/bus/bustest"
+)
+
+// describedJob is a message that carries its class metadata
+type describedJob struct {
+	N int `cbor:"n"`
+}
+
+func (describedJob) String() string { return "described" }
+
+func (describedJob) MessageInfo() bus.MessageInfo {
+	return bus.MessageInfo{Name: "DescribedJob", Module: "jobs.queries", Version: 3}
+}
+
+func TestMessageInfoReachesHandler(t *testing.T) {
+	factory := bus.NewHandlerFactory()
+	bus.Handle(factory, "described", func(ctx context.Context, j describedJob) (bus.MessageInfo, error) {
+		info, _ := bus.MessageInfoFromContext(ctx)
+		return info, nil
+	})
+	b := bustest.NewBus(t, factory)
+
+	got, err := bus.Call[describedJob, bus.MessageInfo](t.Context(), b.Bus, describedJob{N: 1})
+	if err != nil {
+		t.Fatalf("call: %v", err)
+	}
+	if want := (describedJob{}).MessageInfo(); got != want {
+		t.Fatalf("message info: got %+v, want %+v", got, want)
+	}
+}
+
+func TestMessageInfoOfPlainMessageIsEmpty(t *testing.T) {
+	data, err := bus.EncodeMessageInfo(job{})
+	if err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	if len(data) != 1 || data[0] != 0xa0 {
+		t.Fatalf("encoded: got %x, want an empty CBOR map", data)
+	}
+}
@@ -0,0 +1,100 @@
+package bus
+
+import (
+	"time"
+)
+
+// lagInterval is how often consumer lag is sampled for Metrics
+const lagInterval = 15 * time.Second
+
+// Metrics receives bus measurements per stream
+// Implement it to report into your own registry, PrometheusMetrics is the built-in implementation
+// Methods are called concurrently from every stream goroutine
+type Metrics interface {
+	// MessagePublished is called when a message is added to the stream
+	MessagePublished(stream string)
+	// MessageConsumed is called when a message is read from the stream, before it is handled
+	MessageConsumed(stream string)
+	// MessageHandled is called once per message with the total handling time, retries included
+	// err is nil when the handler succeeded
+	MessageHandled(stream string, duration time.Duration, err error)
+	// MessageRetried is called before every repeated handler attempt
+	MessageRetried(stream string)
+	// MessageTimedOut is called when a request is answered with ErrRequestTimeout
+	MessageTimedOut(stream string)
+	// EndToEndLatency is called with the time from the request CreatedTimestamp until it was handled
+	EndToEndLatency(stream string, latency time.Duration)
+	// InFlight is called with +1 when handling of a message starts and -1 when it ends
+	InFlight(stream string, delta int)
+	// ConsumerLag is called periodically with the number of entries not yet delivered to the consumer group
+	ConsumerLag(stream string, lag int64)
+}
+
+// nopMetrics discards every measurement
+type nopMetrics struct{}
+
+func (nopMetrics) MessagePublished(string)                     {}
+func (nopMetrics) MessageConsumed(string)                      {}
+func (nopMetrics) MessageHandled(string, time.Duration, error) {}
+func (nopMetrics) MessageRetried(string)                       {}
+func (nopMetrics) MessageTimedOut(string)                      {}
+func (nopMetrics) EndToEndLatency(string, time.Duration)       {}
+func (nopMetrics) InFlight(string, int)                        {}
+func (nopMetrics) ConsumerLag(string, int64)                   {}
+
+// SetMetrics sets where the bus reports measurements, nil disables reporting
+func (b *Bus) SetMetrics(metrics Metrics) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if metrics == nil {
+		metrics = nopMetrics{}
+	}
+	b.metrics = metrics
+}
+
+// metricsSink returns the configured Metrics
+func (b *Bus) metricsSink() Metrics {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.metrics
+}
+
+// observeHandled reports the outcome and latencies of a handled request
+func (b *Bus) observeHandled(streamName string, req *TransportRequest, started time.Time, err error) {
+	metrics := b.metricsSink()
+	now := time.Now()
+	metrics.MessageHandled(streamName, now.Sub(started), err)
+	if req.CreatedTimestamp > 0 {
+		created := time.Unix(0, int64(req.CreatedTimestamp*1e9))
+		metrics.EndToEndLatency(streamName, now.Sub(created))
+	}
+}
+
+// sampleLag periodically reports the consumer group lag of the stream
+// The sink is checked on every tick, so metrics set after Run starts are sampled too
+func (b *Bus) sampleLag(streamName string, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-b.ctx.Done():
+			return
+		case <-ticker.C:
+			metrics := b.metricsSink()
+			if _, ok := metrics.(nopMetrics); ok {
+				continue
+			}
+			lag, err := b.transport.GroupLag(b.ctx, streamName, b.group)
+			if err != nil {
+				if b.ctx.Err() == nil {
+					b.log().Error("Failed to read consumer lag", LogKeyStream, streamName, LogKeyError, err)
+				}
+				continue
+			}
+			if lag >= 0 {
+				metrics.ConsumerLag(streamName, lag)
+			}
+		}
+	}
+}
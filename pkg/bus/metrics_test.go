@@ -0,0 +1,56 @@
+package bus
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// lagRecorder delivers every sampled consumer lag to lags
+type lagRecorder struct {
+	nopMetrics
+	lags chan int64
+}
+
+func (r lagRecorder) ConsumerLag(stream string, lag int64) {
+	select {
+	case r.lags <- lag:
+	default:
+	}
+}
+
+func TestSampleLagPicksUpMetricsSetAfterStart(t *testing.T) {
+	transport := NewMemoryTransport()
+	if err := transport.CreateGroup(t.Context(), "jobs", DefaultConsumerGroup, "$"); err != nil {
+		t.Fatalf("create group: %v", err)
+	}
+	if _, err := transport.Add(t.Context(), "jobs", map[string]interface{}{"p": "1"}, 0); err != nil {
+		t.Fatalf("add: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(t.Context())
+	b := NewBusWithTransport(transport, ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		b.sampleLag("jobs", 5*time.Millisecond)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	// A few ticks pass with the default sink before metrics are set
+	time.Sleep(20 * time.Millisecond)
+	recorder := lagRecorder{lags: make(chan int64, 1)}
+	b.SetMetrics(recorder)
+
+	select {
+	case lag := <-recorder.lags:
+		if lag != 1 {
+			t.Fatalf("consumer lag: got %d, want 1", lag)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("consumer lag not sampled after SetMetrics")
+	}
+}
@@ -0,0 +1,166 @@
+package bus
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+	"time"
+)
+
+// HandlerFunc handles a single consumed message
+// It is the unit wrapped by consumer-side middleware around Subscriber.Handle
+type HandlerFunc func(ctx context.Context, req *TransportRequest) (any, error)
+
+// HandlerMiddleware wraps a HandlerFunc with cross-cutting behavior
+type HandlerMiddleware func(next HandlerFunc) HandlerFunc
+
+// PublishFunc sends a message to a stream and, for Execute, waits for the response
+// Emit calls return an empty Response
+type PublishFunc func(ctx context.Context, streamName string, req *TransportRequest) (Response, error)
+
+// PublishMiddleware wraps a PublishFunc with cross-cutting behavior
+type PublishMiddleware func(next PublishFunc) PublishFunc
+
+// PanicErrorClass is the ErrorClass sent to the caller when a handler panics
+const PanicErrorClass = "HandlerPanicError"
+
+// PanicError is returned when a handler or its constructor panics
+// The stack trace is logged and never sent to the caller
+type PanicError struct {
+	Value any
+	Stack []byte
+}
+
+// Error implements the error interface
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("handler panic: %v", e.Value)
+}
+
+// Use registers consumer-side middleware applied to every stream
+// Middleware registered first runs outermost
+func (b *Bus) Use(mw ...HandlerMiddleware) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.handlerMiddleware = append(b.handlerMiddleware, mw...)
+}
+
+// UsePublish registers producer-side middleware applied to every Execute and Emit call
+// Middleware registered first runs outermost
+func (b *Bus) UsePublish(mw ...PublishMiddleware) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.publishMiddleware = append(b.publishMiddleware, mw...)
+}
+
+// handlerChain wraps the subscriber with global middleware and the stream middleware from the factory
+func (b *Bus) handlerChain(streamName string, factory *HandlerFactory, subscriber Subscriber) HandlerFunc {
+	b.mu.RLock()
+	global := b.handlerMiddleware
+	b.mu.RUnlock()
+
+	h := func(ctx context.Context, req *TransportRequest) (any, error) {
+		return subscriber.Handle(ctx)
+	}
+	h = chainHandler(h, factory.middleware(streamName))
+	h = chainHandler(h, global)
+	// The bus always isolates panics, including those raised by middleware
+	return Recover()(h)
+}
+
+// publishChain wraps the publish function with the global producer-side middleware
+// Middleware gets the bus logger from the context, not the logger of a handler that publishes
+func (b *Bus) publishChain(p PublishFunc) PublishFunc {
+	b.mu.RLock()
+	mw := b.publishMiddleware
+	logger := orDefault(b.logger)
+	b.mu.RUnlock()
+
+	for i := len(mw) - 1; i >= 0; i-- {
+		p = mw[i](p)
+	}
+	return func(ctx context.Context, streamName string, req *TransportRequest) (Response, error) {
+		return p(ContextWithLogger(ctx, logger), streamName, req)
+	}
+}
+
+// chainHandler applies middleware so that the first one runs outermost
+func chainHandler(h HandlerFunc, mw []HandlerMiddleware) HandlerFunc {
+	for i := len(mw) - 1; i >= 0; i-- {
+		h = mw[i](h)
+	}
+	return h
+}
+
+// Recover converts handler panics into a *PanicError response
+// The bus always applies it outermost; register it explicitly to recover inside other middleware
+func Recover() HandlerMiddleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx context.Context, req *TransportRequest) (result any, err error) {
+			defer func() {
+				if v := recover(); v != nil {
+					err = &PanicError{Value: v, Stack: debug.Stack()}
+					LoggerFromContext(ctx).Error("Recovered handler panic", "panic", v, "stack", string(err.(*PanicError).Stack))
+				}
+			}()
+			return next(ctx, req)
+		}
+	}
+}
+
+// Logging logs every handled message with its outcome and duration
+func Logging() HandlerMiddleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx context.Context, req *TransportRequest) (any, error) {
+			start := time.Now()
+			result, err := next(ctx, req)
+			logger := LoggerFromContext(ctx)
+			if err != nil {
+				logger.Warn("Handled message", LogKeyDuration, time.Since(start), LogKeyError, err)
+			} else {
+				logger.Info("Handled message", LogKeyDuration, time.Since(start))
+			}
+			return result, err
+		}
+	}
+}
+
+// Timing reports the duration and outcome of every handled message to the observer
+func Timing(observe func(streamName string, duration time.Duration, err error)) HandlerMiddleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx context.Context, req *TransportRequest) (any, error) {
+			start := time.Now()
+			result, err := next(ctx, req)
+			observe(req.Stream, time.Since(start), err)
+			return result, err
+		}
+	}
+}
+
+// PublishLogging logs every Execute and Emit call with its outcome and duration
+func PublishLogging() PublishMiddleware {
+	return func(next PublishFunc) PublishFunc {
+		return func(ctx context.Context, streamName string, req *TransportRequest) (Response, error) {
+			start := time.Now()
+			resp, err := next(ctx, streamName, req)
+			logger := LoggerFromContext(ctx).With(LogKeyStream, streamName, LogKeyRequestID, req.RequestID)
+			if err != nil {
+				logger.Warn("Published message", LogKeyDuration, time.Since(start), LogKeyError, err)
+			} else {
+				logger.Info("Published message", LogKeyDuration, time.Since(start))
+			}
+			return resp, err
+		}
+	}
+}
+
+// PublishTiming reports the duration and outcome of every Execute and Emit call to the observer
+func PublishTiming(observe func(streamName string, duration time.Duration, err error)) PublishMiddleware {
+	return func(next PublishFunc) PublishFunc {
+		return func(ctx context.Context, streamName string, req *TransportRequest) (Response, error) {
+			start := time.Now()
+			resp, err := next(ctx, streamName, req)
+			observe(streamName, time.Since(start), err)
+			return resp, err
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package bus_test
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"testing"
+
+	"github.com/PavelRadostev/toolkit/pkg/bus"
+)
+
+// callLog records the order in which middleware and handlers run
+type callLog struct {
+	mu    sync.Mutex
+	calls []string
+}
+
+func (l *callLog) add(call string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.calls = append(l.calls, call)
+}
+
+func (l *callLog) recorded() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return slices.Clone(l.calls)
+}
+
+// handler returns middleware recording its entry and exit under name
+func (l *callLog) handler(name string) bus.HandlerMiddleware {
+	return func(next bus.HandlerFunc) bus.HandlerFunc {
+		return func(ctx context.Context, req *bus.TransportRequest) (any, error) {
+			l.add(name + ">")
+			defer l.add(name + "<")
+			return next(ctx, req)
+		}
+	}
+}
+
+// publish returns publish middleware recording its entry and exit under name
+func (l *callLog) publish(name string) bus.PublishMiddleware {
+	return func(next bus.PublishFunc) bus.PublishFunc {
+		return func(ctx context.Context, streamName string, req *bus.TransportRequest) (bus.Response, error) {
+			l.add(name + ">")
+			defer l.add(name + "<")
+			return next(ctx, streamName, req)
+		}
+	}
+}
+
+func TestMiddlewareOrder(t *testing.T) {
+	transport := bus.NewMemoryTransport()
+	var log callLog
+	factory := bus.NewHandlerFactory()
+	bus.Handle(factory, "jobs", func(ctx context.Context, j job) (int, error) {
+		log.add("handler")
+		return j.N, nil
+	})
+	factory.Use("jobs", log.handler("stream1"), log.handler("stream2"))
+
+	b := newBus(transport, factory)
+	b.Use(log.handler("global1"), log.handler("global2"))
+	b.Register("jobs")
+	runBus(t, b, transport, bus.DefaultConsumerGroup, "jobs")
+
+	if _, err := bus.Call[job, int](t.Context(), b, job{Stream: "jobs", N: 1}); err != nil {
+		t.Fatalf("call: %v", err)
+	}
+	want := []string{
+		"global1>", "global2>", "stream1>", "stream2>", "handler",
+		"stream2<", "stream1<", "global2<", "global1<",
+	}
+	// The response is pushed after the chain returns, so the whole chain is recorded by now
+	if got := log.recorded(); !slices.Equal(got, want) {
+		t.Fatalf("handler chain order: got %v, want %v", got, want)
+	}
+
+	var published callLog
+	b.UsePublish(published.publish("publish1"), published.publish("publish2"))
+	if err := b.Emit(t.Context(), job{Stream: "jobs", N: 2}); err != nil {
+		t.Fatalf("emit: %v", err)
+	}
+	if got, want := published.recorded(), []string{"publish1>", "publish2>", "publish2<", "publish1<"}; !slices.Equal(got, want) {
+		t.Fatalf("publish chain order: got %v, want %v", got, want)
+	}
+}
+
+func TestStreamMiddlewareAppliesToItsStreamOnly(t *testing.T) {
+	transport := bus.NewMemoryTransport()
+	var log callLog
+	factory := bus.NewHandlerFactory()
+	handle := func(ctx context.Context, j job) (int, error) {
+		log.add("handler")
+		return j.N, nil
+	}
+	bus.Handle(factory, "jobs.a", handle)
+	bus.Handle(factory, "jobs.b", handle)
+	factory.Use("jobs.a", log.handler("a"))
+
+	b := newBus(transport, factory)
+	b.Register("jobs.a")
+	b.Register("jobs.b")
+	runBus(t, b, transport, bus.DefaultConsumerGroup, "jobs.a", "jobs.b")
+
+	if _, err := bus.Call[job, int](t.Context(), b, job{Stream: "jobs.b", N: 1}); err != nil {
+		t.Fatalf("call jobs.b: %v", err)
+	}
+	if got, want := log.recorded(), []string{"handler"}; !slices.Equal(got, want) {
+		t.Fatalf("jobs.b chain: got %v, want the handler only", got)
+	}
+
+	if _, err := bus.Call[job, int](t.Context(), b, job{Stream: "jobs.a", N: 1}); err != nil {
+		t.Fatalf("call jobs.a: %v", err)
+	}
+	if got, want := log.recorded(), []string{"handler", "a>", "handler", "a<"}; !slices.Equal(got, want) {
+		t.Fatalf("jobs.a chain: got %v, want %v", got, want)
+	}
+}
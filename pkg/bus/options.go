@@ -0,0 +1,62 @@
+package bus
+
+import (
+	"context"
+	"time"
+)
+
+// CallOption configures a single Execute or Emit call
+type CallOption func(*callOptions)
+
+// callOptions holds per-call settings written into the TransportRequest
+type callOptions struct {
+	timeout      time.Duration
+	returnResult bool
+}
+
+// WithTimeout sets how long the caller waits for the response
+// The timeout is sent in the "t" field so the consumer skips requests the caller gave up on
+func WithTimeout(timeout time.Duration) CallOption {
+	return func(o *callOptions) {
+		if timeout > 0 {
+			o.timeout = timeout
+		}
+	}
+}
+
+// WithReturnResult overrides whether the consumer should send a response
+func WithReturnResult(returnResult bool) CallOption {
+	return func(o *callOptions) {
+		o.returnResult = returnResult
+	}
+}
+
+// newCallOptions applies the options on top of the defaults
+// A context deadline sooner than the timeout shortens it
+func newCallOptions(ctx context.Context, returnResult bool, opts []CallOption) callOptions {
+	o := callOptions{
+		timeout:      time.Duration(DefaultTimeout) * time.Second,
+		returnResult: returnResult,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		o.timeout = min(o.timeout, time.Until(deadline))
+	}
+	return o
+}
+
+// timeoutSeconds returns the timeout for the "t" field rounded up to whole seconds
+func (o callOptions) timeoutSeconds() int {
+	seconds := int((o.timeout + time.Second - 1) / time.Second)
+	return max(seconds, 1)
+}
+
+// returnResultFlag returns the value for the "r" field
+func (o callOptions) returnResultFlag() int {
+	if o.returnResult {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,49 @@
+// Package outbox sends bus messages together with Postgres transactions
+//
+// Emit stores the message in the outbox table within the caller's transaction,
+// Relay publishes committed rows to the bus in the order of the transactions that wrote them
+package outbox
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/PavelRadostev/toolkit/pkg/bus"
+	"github.com/jackc/pgx/v5"
+)
+
+// Table is the outbox table created by migrations/000001_create_bus_outbox.up.sql
+const Table = "bus_outbox"
+
+// Emit stores the message in the outbox within tx
+// The message reaches the bus only if tx commits, the relay sends it at least once
+// It carries the trace context headers stored in ctx with bus.ContextWithTraceCarrier, see EmitTraced for spans
+func Emit(ctx context.Context, tx pgx.Tx, pub bus.Publisher, opts ...bus.CallOption) error {
+	return EmitTraced(ctx, tx, nil, pub, opts...)
+}
+
+// EmitTraced stores the message in the outbox within tx with the trace context of ctx written by tracer,
+// so the handler span continues the trace of the transaction rather than of the relay
+// Pass the Tracer set on the bus with SetTracer, nil behaves like Emit
+func EmitTraced(ctx context.Context, tx pgx.Tx, tracer bus.Tracer, pub bus.Publisher, opts ...bus.CallOption) error {
+	req, err := bus.NewRequest(pub, opts...)
+	if err != nil {
+		return err
+	}
+	if err := req.InjectTraceContext(ctx, tracer); err != nil {
+		return err
+	}
+	data, err := req.Encode()
+	if err != nil {
+		return fmt.Errorf("failed to encode transport request: %w", err)
+	}
+
+	_, err = tx.Exec(ctx,
+		`INSERT INTO `+Table+` (stream, request_id, request) VALUES ($1, $2, $3)`,
+		pub.String(), req.RequestID, data,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to insert outbox message: %w", err)
+	}
+	return nil
+}
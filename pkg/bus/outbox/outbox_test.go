@@ -0,0 +1,263 @@
+package outbox_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/PavelRadostev/toolkit/pkg/bus"
+	"github.com/PavelRadostev/toolkit/pkg/bus/outbox"
+	"github.com/PavelRadostev/toolkit/pkg/db"
+	"github.com/fxamacker/cbor/v2"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// planApproved is the event sent through the outbox in tests
+type planApproved struct {
+	PlanID int `cbor:"plan_id"`
+}
+
+// String returns the stream name of the event
+func (planApproved) String() string {
+	return "plans"
+}
+
+// Serialize encodes the event to CBOR
+func (e planApproved) Serialize() ([]byte, error) {
+	return cbor.Marshal(e)
+}
+
+// newPool connects to the database in BUS_TEST_POSTGRES_DSN and creates the outbox table in a schema
+// of its own, dropped when the test ends; the test is skipped when the variable is not set
+func newPool(t *testing.T) *db.Pool {
+	t.Helper()
+
+	dsn := os.Getenv("BUS_TEST_POSTGRES_DSN")
+	if dsn == "" {
+		t.Skip("BUS_TEST_POSTGRES_DSN is not set")
+	}
+	ctx := context.Background()
+
+	admin, err := pgx.Connect(ctx, dsn)
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	schema := fmt.Sprintf("bus_outbox_test_%d", time.Now().UnixNano())
+	if _, err := admin.Exec(ctx, "CREATE SCHEMA "+schema); err != nil {
+		t.Fatalf("create schema: %v", err)
+	}
+	t.Cleanup(func() {
+		if _, err := admin.Exec(context.Background(), "DROP SCHEMA "+schema+" CASCADE"); err != nil {
+			t.Errorf("drop schema: %v", err)
+		}
+		admin.Close(context.Background())
+	})
+
+	cfg, err := pgxpool.ParseConfig(dsn)
+	if err != nil {
+		t.Fatalf("parse DSN: %v", err)
+	}
+	cfg.ConnConfig.RuntimeParams["search_path"] = schema
+	pool, err := pgxpool.NewWithConfig(ctx, cfg)
+	if err != nil {
+		t.Fatalf("create pool: %v", err)
+	}
+	t.Cleanup(pool.Close)
+
+	migration, err := os.ReadFile("../../../migrations/000001_create_bus_outbox.up.sql")
+	if err != nil {
+		t.Fatalf("read migration: %v", err)
+	}
+	if _, err := pool.Exec(ctx, string(migration)); err != nil {
+		t.Fatalf("apply migration: %v", err)
+	}
+	return &db.Pool{Pool: pool}
+}
+
+// newRelay creates a relay publishing to a bus on top of a MemoryTransport
+func newRelay(pool *db.Pool) (*outbox.Relay, bus.Transport) {
+	transport := bus.NewMemoryTransport()
+	b := bus.NewBusWithTransport(transport, context.Background())
+	b.SetLogger(slog.New(slog.DiscardHandler))
+	relay := outbox.NewRelay(pool, b)
+	relay.SetLogger(slog.New(slog.DiscardHandler))
+	return relay, transport
+}
+
+// emit stores the events in the outbox within one transaction and commits it
+func emit(t *testing.T, pool *db.Pool, planIDs ...int) {
+	t.Helper()
+
+	tx := begin(t, pool, planIDs...)
+	if err := tx.Commit(t.Context()); err != nil {
+		t.Fatalf("commit: %v", err)
+	}
+}
+
+// begin stores the events in the outbox within a transaction left open, rolled back when the test ends
+func begin(t *testing.T, pool *db.Pool, planIDs ...int) pgx.Tx {
+	t.Helper()
+
+	tx, err := pool.Begin(t.Context())
+	if err != nil {
+		t.Fatalf("begin: %v", err)
+	}
+	t.Cleanup(func() { tx.Rollback(context.Background()) })
+	for _, id := range planIDs {
+		if err := outbox.Emit(t.Context(), tx, planApproved{PlanID: id}); err != nil {
+			t.Fatalf("emit %d: %v", id, err)
+		}
+	}
+	return tx
+}
+
+// flush runs the relay until it has published want rows, since transactions of other tests
+// sharing the database may hold rows back for a moment
+func flush(t *testing.T, relay *outbox.Relay, want int) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	published := 0
+	for published < want {
+		n, err := relay.Flush(t.Context())
+		if err != nil {
+			t.Fatalf("flush: %v", err)
+		}
+		published += n
+		if n == 0 {
+			if time.Now().After(deadline) {
+				t.Fatalf("published %d rows, want %d", published, want)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	if published != want {
+		t.Fatalf("published %d rows, want %d", published, want)
+	}
+}
+
+// publishedPlans returns the plan IDs of the events in the stream in stream order
+func publishedPlans(t *testing.T, transport bus.Transport) []int {
+	t.Helper()
+
+	entries, err := transport.Read(t.Context(), "plans", "0-0", 100, 0)
+	if err != nil {
+		t.Fatalf("read stream: %v", err)
+	}
+	var ids []int
+	for _, entry := range entries {
+		req, err := bus.DecodeEntry(entry)
+		if err != nil {
+			t.Fatalf("decode entry: %v", err)
+		}
+		var event planApproved
+		if err := cbor.Unmarshal(req.Message, &event); err != nil {
+			t.Fatalf("decode event: %v", err)
+		}
+		ids = append(ids, event.PlanID)
+	}
+	return ids
+}
+
+func TestEmitPublishesCommittedRows(t *testing.T) {
+	pool := newPool(t)
+	relay, transport := newRelay(pool)
+
+	emit(t, pool, 1, 2)
+	rolledBack := begin(t, pool, 3)
+	if err := rolledBack.Rollback(t.Context()); err != nil {
+		t.Fatalf("rollback: %v", err)
+	}
+
+	flush(t, relay, 2)
+	if got := publishedPlans(t, transport); !slices.Equal(got, []int{1, 2}) {
+		t.Fatalf("published plans: got %v, want [1 2]", got)
+	}
+	if n, err := relay.Flush(t.Context()); err != nil || n != 0 {
+		t.Fatalf("flush again: got %d (%v), want nothing left", n, err)
+	}
+
+	var unpublished int
+	if err := pool.QueryRow(t.Context(), `SELECT count(*) FROM `+outbox.Table+` WHERE published_at IS NULL`).Scan(&unpublished); err != nil {
+		t.Fatalf("count unpublished rows: %v", err)
+	}
+	if unpublished != 0 {
+		t.Fatalf("unpublished rows: got %d, want 0", unpublished)
+	}
+}
+
+func TestFlushWaitsForOlderTransactions(t *testing.T) {
+	pool := newPool(t)
+	relay, transport := newRelay(pool)
+
+	// The older transaction commits last, its row must still come first
+	older := begin(t, pool, 1)
+	emit(t, pool, 2)
+	if n, err := relay.Flush(t.Context()); err != nil || n != 0 {
+		t.Fatalf("flush with an older transaction running: got %d (%v), want the row held back", n, err)
+	}
+	if err := older.Commit(t.Context()); err != nil {
+		t.Fatalf("commit older transaction: %v", err)
+	}
+
+	flush(t, relay, 2)
+	if got := publishedPlans(t, transport); !slices.Equal(got, []int{1, 2}) {
+		t.Fatalf("published plans: got %v, want [1 2] in transaction order", got)
+	}
+}
+
+func TestFlushWarnsAboutHeldBackRows(t *testing.T) {
+	pool := newPool(t)
+	relay, _ := newRelay(pool)
+	var logs bytes.Buffer
+	relay.SetLogger(slog.New(slog.NewTextHandler(&logs, nil)))
+	relay.SetStallWarning(time.Nanosecond)
+
+	begin(t, pool, 1)
+	emit(t, pool, 2)
+	if n, err := relay.Flush(t.Context()); err != nil || n != 0 {
+		t.Fatalf("flush: got %d (%v), want the row held back", n, err)
+	}
+	if !strings.Contains(logs.String(), "held back by a long-running transaction") || !strings.Contains(logs.String(), "rows=1") {
+		t.Fatalf("log: got %q, want a warning about 1 held back row", logs.String())
+	}
+}
+
+func TestFlushSkipsUndecodableRows(t *testing.T) {
+	pool := newPool(t)
+	relay, transport := newRelay(pool)
+
+	if _, err := pool.Exec(t.Context(),
+		`INSERT INTO `+outbox.Table+` (stream, request_id, request) VALUES ('plans', 'broken', '\xff')`,
+	); err != nil {
+		t.Fatalf("insert broken row: %v", err)
+	}
+	emit(t, pool, 1)
+
+	flush(t, relay, 1)
+	if got := publishedPlans(t, transport); !slices.Equal(got, []int{1}) {
+		t.Fatalf("published plans: got %v, want [1]", got)
+	}
+
+	var (
+		attempts  int
+		lastError *string
+		published bool
+	)
+	err := pool.QueryRow(t.Context(),
+		`SELECT attempts, last_error, published_at IS NOT NULL FROM `+outbox.Table+` WHERE request_id = 'broken'`,
+	).Scan(&attempts, &lastError, &published)
+	if err != nil {
+		t.Fatalf("select broken row: %v", err)
+	}
+	if attempts != 1 || lastError == nil || !published {
+		t.Fatalf("broken row: got %d attempts, error %v, published %t, want it skipped", attempts, lastError, published)
+	}
+}
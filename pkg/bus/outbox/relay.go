@@ -0,0 +1,286 @@
+package outbox
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync/atomic"
+	"time"
+
+	"github.com/PavelRadostev/toolkit/pkg/bus"
+	"github.com/PavelRadostev/toolkit/pkg/db"
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	// DefaultInterval is how often the relay polls for pending rows
+	DefaultInterval = time.Second
+	// DefaultBatchSize is the maximum number of rows published per transaction
+	DefaultBatchSize = 100
+	// DefaultRetention is how long published rows are kept before cleanup
+	DefaultRetention = 24 * time.Hour
+	// DefaultStallWarning is how long committed rows may wait for older transactions before the relay warns
+	DefaultStallWarning = time.Minute
+
+	// cleanupInterval is how often published rows older than the retention are deleted
+	cleanupInterval = 10 * time.Minute
+	// relayLockKey is the advisory lock that lets a single relay publish at a time, keeping the order
+	relayLockKey int64 = 0x6275736f7574626f // "busoutbo"
+)
+
+// Relay publishes committed outbox rows to the bus
+// Rows are sent ordered by the ID of the transaction that wrote them, then by insertion order,
+// and only once every transaction with a lower ID has finished, so a row committed later never
+// takes a place before one already published. Rows are marked published after sending, so a crash
+// in between sends them again: consumers must tolerate duplicates with the same request ID
+// A long-running transaction anywhere in the database, even one that never touches the outbox,
+// holds back every row written after it started until it ends; the relay logs a warning when
+// rows wait longer than the stall warning
+type Relay struct {
+	pool         *db.Pool
+	bus          *bus.Bus
+	interval     time.Duration
+	batchSize    int
+	retention    time.Duration
+	stallWarning time.Duration
+	// stallWarned is the Unix time in nanoseconds of the last stall warning
+	stallWarned atomic.Int64
+	logger      *slog.Logger
+}
+
+// outboxRow is a pending outbox row
+type outboxRow struct {
+	id      int64
+	stream  string
+	request []byte
+}
+
+// NewRelay creates a relay publishing rows of the pool's outbox table to the bus
+func NewRelay(pool *db.Pool, b *bus.Bus) *Relay {
+	return &Relay{
+		pool:         pool,
+		bus:          b,
+		interval:     DefaultInterval,
+		batchSize:    DefaultBatchSize,
+		retention:    DefaultRetention,
+		stallWarning: DefaultStallWarning,
+	}
+}
+
+// SetInterval sets how often the relay polls for pending rows
+func (r *Relay) SetInterval(interval time.Duration) {
+	if interval > 0 {
+		r.interval = interval
+	}
+}
+
+// SetBatchSize sets the maximum number of rows published per transaction
+func (r *Relay) SetBatchSize(n int) {
+	if n > 0 {
+		r.batchSize = n
+	}
+}
+
+// SetRetention sets how long published rows are kept, zero disables cleanup
+func (r *Relay) SetRetention(retention time.Duration) {
+	r.retention = retention
+}
+
+// SetStallWarning sets how long rows may be held back by running transactions before the relay
+// logs a warning, at most once per that period; zero disables the warning
+func (r *Relay) SetStallWarning(d time.Duration) {
+	r.stallWarning = d
+}
+
+// SetLogger sets the logger of the relay, nil means slog.Default()
+func (r *Relay) SetLogger(logger *slog.Logger) {
+	r.logger = logger
+}
+
+// log returns the configured logger
+func (r *Relay) log() *slog.Logger {
+	if r.logger == nil {
+		return slog.Default()
+	}
+	return r.logger
+}
+
+// Run publishes pending rows until ctx is done
+// A full batch is followed by the next one right away, otherwise the relay waits for the interval
+func (r *Relay) Run(ctx context.Context) error {
+	r.log().Info("Starting outbox relay")
+
+	lastCleanup := time.Time{}
+	for {
+		if r.retention > 0 && time.Since(lastCleanup) >= cleanupInterval {
+			if _, err := r.Cleanup(ctx); err != nil && ctx.Err() == nil {
+				r.log().Error("Failed to clean up outbox", bus.LogKeyError, err)
+			}
+			lastCleanup = time.Now()
+		}
+
+		n, err := r.Flush(ctx)
+		if err != nil && ctx.Err() == nil {
+			r.log().Error("Failed to relay outbox rows", bus.LogKeyError, err)
+		}
+		if err == nil && n == r.batchSize {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			r.log().Info("Outbox relay stopped")
+			return nil
+		case <-time.After(r.interval):
+		}
+	}
+}
+
+// Flush publishes one batch of pending rows and returns how many were published
+// Publishing stops at the first failure so later rows of the batch do not overtake the failed one
+// Returns 0 without error when another relay holds the lock
+func (r *Relay) Flush(ctx context.Context) (int, error) {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin outbox transaction: %w", err)
+	}
+	defer tx.Rollback(context.Background())
+
+	var locked bool
+	if err := tx.QueryRow(ctx, `SELECT pg_try_advisory_xact_lock($1)`, relayLockKey).Scan(&locked); err != nil {
+		return 0, fmt.Errorf("failed to take outbox lock: %w", err)
+	}
+	if !locked {
+		return 0, nil
+	}
+
+	rows, err := r.pending(ctx, tx)
+	if err != nil {
+		return 0, err
+	}
+	if len(rows) < r.batchSize {
+		r.checkStalled(ctx, tx)
+	}
+
+	var (
+		published []int64
+		sendErr   error
+	)
+	for _, row := range rows {
+		req, err := bus.DecodeTransportRequest(row.request)
+		if err != nil {
+			// A row that cannot be decoded never will be, do not let it block the rest
+			r.log().Error("Skipping undecodable outbox row", "row", row.id, bus.LogKeyStream, row.stream, bus.LogKeyError, err)
+			if err := r.markFailed(ctx, tx, row.id, err, true); err != nil {
+				return 0, err
+			}
+			continue
+		}
+		if err := r.bus.EmitRequest(ctx, row.stream, req); err != nil {
+			sendErr = fmt.Errorf("failed to publish outbox row %d to stream %s: %w", row.id, row.stream, err)
+			if err := r.markFailed(ctx, tx, row.id, err, false); err != nil {
+				return 0, err
+			}
+			break
+		}
+		published = append(published, row.id)
+	}
+
+	if len(published) > 0 {
+		if _, err := tx.Exec(ctx, `UPDATE `+Table+` SET published_at = now() WHERE id = ANY($1)`, published); err != nil {
+			return 0, fmt.Errorf("failed to mark outbox rows published: %w", err)
+		}
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("failed to commit outbox transaction: %w", err)
+	}
+	return len(published), sendErr
+}
+
+// pending selects the next batch of unpublished rows written by transactions older than every running one
+// A BIGSERIAL id is taken before commit, so a transaction still running may yet commit a row with a lower id;
+// rows of transactions below the snapshot xmin can no longer be joined by such rows
+func (r *Relay) pending(ctx context.Context, tx pgx.Tx) ([]outboxRow, error) {
+	rows, err := tx.Query(ctx,
+		`SELECT id, stream, request FROM `+Table+`
+		WHERE published_at IS NULL AND txid < pg_snapshot_xmin(pg_current_snapshot())
+		ORDER BY txid, id LIMIT $1`,
+		r.batchSize,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to select outbox rows: %w", err)
+	}
+	defer rows.Close()
+
+	var result []outboxRow
+	for rows.Next() {
+		var row outboxRow
+		if err := rows.Scan(&row.id, &row.stream, &row.request); err != nil {
+			return nil, fmt.Errorf("failed to scan outbox row: %w", err)
+		}
+		result = append(result, row)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read outbox rows: %w", err)
+	}
+	return result, nil
+}
+
+// checkStalled warns when unpublished rows have waited longer than the stall warning
+// because transactions older than theirs are still running
+func (r *Relay) checkStalled(ctx context.Context, tx pgx.Tx) {
+	if r.stallWarning <= 0 || time.Since(time.Unix(0, r.stallWarned.Load())) < r.stallWarning {
+		return
+	}
+
+	var (
+		count int64
+		age   *float64
+	)
+	err := tx.QueryRow(ctx,
+		`SELECT count(*), extract(epoch FROM now() - min(created_at))::float8 FROM `+Table+`
+		WHERE published_at IS NULL AND txid >= pg_snapshot_xmin(pg_current_snapshot())`,
+	).Scan(&count, &age)
+	if err != nil {
+		if ctx.Err() == nil {
+			r.log().Error("Failed to inspect held back outbox rows", bus.LogKeyError, err)
+		}
+		return
+	}
+	if count == 0 || age == nil {
+		return
+	}
+	oldest := time.Duration(*age * float64(time.Second))
+	if oldest < r.stallWarning {
+		return
+	}
+	r.stallWarned.Store(time.Now().UnixNano())
+	r.log().Warn("Outbox rows are held back by a long-running transaction", "rows", count, "oldest_age", oldest)
+}
+
+// markFailed records a failed attempt, a skipped row is also marked published
+func (r *Relay) markFailed(ctx context.Context, tx pgx.Tx, id int64, cause error, skip bool) error {
+	query := `UPDATE ` + Table + ` SET attempts = attempts + 1, last_error = $2 WHERE id = $1`
+	if skip {
+		query = `UPDATE ` + Table + ` SET attempts = attempts + 1, last_error = $2, published_at = now() WHERE id = $1`
+	}
+	if _, err := tx.Exec(ctx, query, id, cause.Error()); err != nil {
+		return fmt.Errorf("failed to record outbox row %d failure: %w", id, err)
+	}
+	return nil
+}
+
+// Cleanup deletes rows published longer than the retention ago and returns how many were deleted
+func (r *Relay) Cleanup(ctx context.Context) (int64, error) {
+	if r.retention <= 0 {
+		return 0, nil
+	}
+	tag, err := r.pool.Exec(ctx,
+		`DELETE FROM `+Table+` WHERE published_at IS NOT NULL AND published_at < $1`,
+		time.Now().Add(-r.retention),
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete published outbox rows: %w", err)
+	}
+	return tag.RowsAffected(), nil
+}
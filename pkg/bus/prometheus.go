@@ -0,0 +1,245 @@
+package bus
+
+import (
+	"fmt"
+	"io"
+	"maps"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultLatencyBuckets are the histogram buckets in seconds used by PrometheusMetrics
+var DefaultLatencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 300}
+
+// PrometheusMetrics implements Metrics in memory and serves them in the Prometheus text format
+// Use it as an http.Handler on the /metrics endpoint
+type PrometheusMetrics struct {
+	namespace string
+	buckets   []float64
+
+	mu         sync.Mutex
+	counters   map[string]map[string]float64
+	gauges     map[string]map[string]float64
+	histograms map[string]map[string]*histogram
+}
+
+// histogram is a cumulative histogram of one stream
+type histogram struct {
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+// metricInfo describes an exposed metric family
+type metricInfo struct {
+	name string
+	kind string
+	help string
+}
+
+// Exposed metric families, in exposition order
+var (
+	metricPublished     = metricInfo{"messages_published_total", "counter", "Messages added to the stream"}
+	metricConsumed      = metricInfo{"messages_consumed_total", "counter", "Messages read from the stream"}
+	metricHandled       = metricInfo{"messages_handled_total", "counter", "Messages handled successfully"}
+	metricFailed        = metricInfo{"messages_failed_total", "counter", "Messages whose handler failed after all attempts"}
+	metricRetried       = metricInfo{"messages_retried_total", "counter", "Repeated handler attempts"}
+	metricTimedOut      = metricInfo{"messages_timed_out_total", "counter", "Requests answered with a timeout"}
+	metricInFlight      = metricInfo{"messages_in_flight", "gauge", "Messages being handled"}
+	metricConsumerLag   = metricInfo{"consumer_lag", "gauge", "Entries not yet delivered to the consumer group"}
+	metricHandleTime    = metricInfo{"handle_duration_seconds", "histogram", "Time spent handling a message, retries included"}
+	metricEndToEndDelay = metricInfo{"end_to_end_latency_seconds", "histogram", "Time from request creation until it was handled"}
+
+	metricFamilies = []metricInfo{
+		metricPublished, metricConsumed, metricHandled, metricFailed, metricRetried, metricTimedOut,
+		metricInFlight, metricConsumerLag, metricHandleTime, metricEndToEndDelay,
+	}
+)
+
+// NewPrometheusMetrics creates an empty registry, metric names are prefixed with namespace
+// An empty namespace means "bus"
+func NewPrometheusMetrics(namespace string) *PrometheusMetrics {
+	if namespace == "" {
+		namespace = "bus"
+	}
+	return &PrometheusMetrics{
+		namespace:  namespace,
+		buckets:    DefaultLatencyBuckets,
+		counters:   make(map[string]map[string]float64),
+		gauges:     make(map[string]map[string]float64),
+		histograms: make(map[string]map[string]*histogram),
+	}
+}
+
+// SetBuckets sets the histogram buckets in seconds and resets recorded histograms
+func (m *PrometheusMetrics) SetBuckets(buckets []float64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.buckets = slices.Sorted(slices.Values(buckets))
+	m.histograms = make(map[string]map[string]*histogram)
+}
+
+// MessagePublished implements Metrics
+func (m *PrometheusMetrics) MessagePublished(stream string) {
+	m.add(m.counters, metricPublished, stream, 1)
+}
+
+// MessageConsumed implements Metrics
+func (m *PrometheusMetrics) MessageConsumed(stream string) {
+	m.add(m.counters, metricConsumed, stream, 1)
+}
+
+// MessageHandled implements Metrics
+func (m *PrometheusMetrics) MessageHandled(stream string, duration time.Duration, err error) {
+	if err != nil {
+		m.add(m.counters, metricFailed, stream, 1)
+	} else {
+		m.add(m.counters, metricHandled, stream, 1)
+	}
+	m.observe(metricHandleTime, stream, duration)
+}
+
+// MessageRetried implements Metrics
+func (m *PrometheusMetrics) MessageRetried(stream string) {
+	m.add(m.counters, metricRetried, stream, 1)
+}
+
+// MessageTimedOut implements Metrics
+func (m *PrometheusMetrics) MessageTimedOut(stream string) {
+	m.add(m.counters, metricTimedOut, stream, 1)
+}
+
+// EndToEndLatency implements Metrics
+func (m *PrometheusMetrics) EndToEndLatency(stream string, latency time.Duration) {
+	m.observe(metricEndToEndDelay, stream, latency)
+}
+
+// InFlight implements Metrics
+func (m *PrometheusMetrics) InFlight(stream string, delta int) {
+	m.add(m.gauges, metricInFlight, stream, float64(delta))
+}
+
+// ConsumerLag implements Metrics
+func (m *PrometheusMetrics) ConsumerLag(stream string, lag int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	series(m.gauges, metricConsumerLag.name)[stream] = float64(lag)
+}
+
+// add increments a counter or gauge of the stream
+func (m *PrometheusMetrics) add(family map[string]map[string]float64, metric metricInfo, stream string, delta float64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	series(family, metric.name)[stream] += delta
+}
+
+// observe records a duration in a histogram of the stream
+func (m *PrometheusMetrics) observe(metric metricInfo, stream string, d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	byStream, ok := m.histograms[metric.name]
+	if !ok {
+		byStream = make(map[string]*histogram)
+		m.histograms[metric.name] = byStream
+	}
+	h, ok := byStream[stream]
+	if !ok {
+		h = &histogram{counts: make([]uint64, len(m.buckets))}
+		byStream[stream] = h
+	}
+
+	seconds := d.Seconds()
+	for i, bound := range m.buckets {
+		if seconds <= bound {
+			h.counts[i]++
+		}
+	}
+	h.sum += seconds
+	h.count++
+}
+
+// series returns the values of a metric by stream, creating the map when missing
+func series(family map[string]map[string]float64, name string) map[string]float64 {
+	byStream, ok := family[name]
+	if !ok {
+		byStream = make(map[string]float64)
+		family[name] = byStream
+	}
+	return byStream
+}
+
+// ServeHTTP writes every metric in the Prometheus text exposition format
+func (m *PrometheusMetrics) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	m.WriteTo(w)
+}
+
+// WriteTo writes every metric in the Prometheus text exposition format
+func (m *PrometheusMetrics) WriteTo(w io.Writer) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var sb strings.Builder
+	for _, metric := range metricFamilies {
+		name := m.namespace + "_" + metric.name
+		switch metric.kind {
+		case "counter", "gauge":
+			family := m.counters
+			if metric.kind == "gauge" {
+				family = m.gauges
+			}
+			byStream := family[metric.name]
+			if len(byStream) == 0 {
+				continue
+			}
+			writeHeader(&sb, name, metric)
+			for _, stream := range slices.Sorted(maps.Keys(byStream)) {
+				fmt.Fprintf(&sb, "%s{stream=\"%s\"} %s\n", name, escapeLabel(stream), formatFloat(byStream[stream]))
+			}
+		case "histogram":
+			byStream := m.histograms[metric.name]
+			if len(byStream) == 0 {
+				continue
+			}
+			writeHeader(&sb, name, metric)
+			for _, stream := range slices.Sorted(maps.Keys(byStream)) {
+				h := byStream[stream]
+				label := escapeLabel(stream)
+				for i, bound := range m.buckets {
+					fmt.Fprintf(&sb, "%s_bucket{stream=\"%s\",le=\"%s\"} %d\n", name, label, formatFloat(bound), h.counts[i])
+				}
+				fmt.Fprintf(&sb, "%s_bucket{stream=\"%s\",le=\"+Inf\"} %d\n", name, label, h.count)
+				fmt.Fprintf(&sb, "%s_sum{stream=\"%s\"} %s\n", name, label, formatFloat(h.sum))
+				fmt.Fprintf(&sb, "%s_count{stream=\"%s\"} %d\n", name, label, h.count)
+			}
+		}
+	}
+
+	n, err := io.WriteString(w, sb.String())
+	return int64(n), err
+}
+
+// writeHeader writes the HELP and TYPE lines of a metric family
+func writeHeader(sb *strings.Builder, name string, metric metricInfo) {
+	fmt.Fprintf(sb, "# HELP %s %s\n", name, metric.help)
+	fmt.Fprintf(sb, "# TYPE %s %s\n", name, metric.kind)
+}
+
+// escapeLabel escapes a label value for the text format
+func escapeLabel(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
+
+// formatFloat formats a sample value for the text format
+func formatFloat(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
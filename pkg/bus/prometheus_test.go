@@ -0,0 +1,59 @@
+package bus_test
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/PavelRadostev/toolkit/pkg/bus"
+)
+
+// scrape returns the metrics in the Prometheus text format
+func scrape(metrics *bus.PrometheusMetrics) string {
+	rec := httptest.NewRecorder()
+	metrics.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	return rec.Body.String()
+}
+
+func TestPrometheusMetricsCountMessages(t *testing.T) {
+	transport := bus.NewMemoryTransport()
+	metrics := bus.NewPrometheusMetrics("")
+	var calls, handled atomic.Int32
+	factory := bus.NewHandlerFactory()
+	bus.HandleEvent(factory, "jobs", func(ctx context.Context, j job) error {
+		if calls.Add(1) == 1 {
+			return errors.New("database unavailable")
+		}
+		handled.Add(1)
+		return nil
+	})
+
+	b := newBus(transport, factory)
+	b.SetMetrics(metrics)
+	b.Register("jobs", bus.WithRetryPolicy(bus.RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond}))
+	runBus(t, b, transport, bus.DefaultConsumerGroup, "jobs")
+
+	if err := b.Emit(t.Context(), job{Stream: "jobs", N: 1}); err != nil {
+		t.Fatalf("emit: %v", err)
+	}
+	eventually(t, time.Second, func() bool {
+		return strings.Contains(scrape(metrics), `bus_messages_handled_total{stream="jobs"} 1`)
+	})
+
+	out := scrape(metrics)
+	for _, want := range []string{
+		`bus_messages_published_total{stream="jobs"} 1`,
+		`bus_messages_consumed_total{stream="jobs"} 1`,
+		`bus_messages_retried_total{stream="jobs"} 1`,
+		`bus_messages_in_flight{stream="jobs"} 0`,
+		`bus_handle_duration_seconds_count{stream="jobs"} 1`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("missing %q in\n%s", want, out)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package bus
+
+import "fmt"
+
+// ProtocolVersion is the version of the wire format shared with the Python library
+//
+// Version 1:
+//
+// A request is a stream entry whose values are strings:
+//
+//	i  request ID, hex UUID without dashes (required)
+//	r  "1" when the caller waits for a response, "0" otherwise (required)
+//	p  CBOR-encoded message properties (required)
+//	m  CBOR-encoded message class info: map with name, module and version, empty map when unknown (optional)
+//	t  timeout in whole seconds, DefaultTimeout when missing (optional)
+//	c  creation time as Unix epoch seconds with fraction, e.g. "1714214741.926557" (optional)
+//	h  CBOR-encoded map of W3C trace context headers: traceparent, tracestate, baggage (optional)
+//	s  "1" when the caller reads a streamed response, intermediate chunks are sent only then (optional)
+//
+// Legacy Go producers put the whole CBOR-encoded TransportRequest into a single "data" value.
+// Unknown values are ignored, so new optional values can be added without a version bump.
+//
+// A response is a CBOR map pushed to the list keyed by the request ID, the list expires after 30 seconds:
+//
+//	req_id         request ID (required)
+//	result         handler result, any CBOR value (optional)
+//	error          error message (optional)
+//	error_class    error class name shared with the Python exception names (optional)
+//	error_details  map with structured error details (optional)
+//	more           true on an intermediate chunk of a streamed response (optional)
+//
+// A streamed response is a sequence of responses pushed to the same list: chunks with more set to true,
+// then the final response without it. Callers that did not set "s" only ever get the final response.
+//
+// Missing and null response values are equivalent.
+const ProtocolVersion = 1
+
+// Stream entry fields of a request
+const (
+	FieldRequestID        = "i"
+	FieldReturnResult     = "r"
+	FieldProperties       = "p"
+	FieldMessage          = "m"
+	FieldTimeout          = "t"
+	FieldCreatedTimestamp = "c"
+	FieldTraceContext     = "h"
+	FieldStreamResponse   = "s"
+	// FieldLegacyData holds a whole CBOR-encoded TransportRequest (legacy Go-to-Go format)
+	FieldLegacyData = "data"
+)
+
+// DecodeEntry decodes a stream entry into a TransportRequest with the default serializer
+// It is the canonical decoder used by Bus for every consumed entry
+func DecodeEntry(entry Entry) (*TransportRequest, error) {
+	return decodeEntry(NewRedisBrokerSerialize(), entry)
+}
+
+// decodeEntry decodes a stream entry with the given serializer
+// Supports both formats: CBOR-encoded "data" value and individual fields
+func decodeEntry(serializer BrokerSerialize, entry Entry) (*TransportRequest, error) {
+	var (
+		req *TransportRequest
+		err error
+	)
+
+	if dataRaw, ok := entry.Values[FieldLegacyData]; ok {
+		// Format 1: CBOR-encoded data in "data" field (legacy Go-to-Go format)
+		var data []byte
+		switch v := dataRaw.(type) {
+		case string:
+			data = []byte(v)
+		case []byte:
+			data = v
+		default:
+			return nil, fmt.Errorf("invalid data type: %T", dataRaw)
+		}
+		req, err = DecodeTransportRequest(data)
+	} else {
+		// Format 2: use broker serializer to deserialize from individual fields
+		req, err = serializer.Deserialize(entry.Values)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// The stream entry ID always wins over anything sent in the payload
+	req.RedisMessageID = entry.ID
+	return req, nil
+}
@@ -0,0 +1,422 @@
+package bus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RedisClient is the go-redis client used by RedisTransport, e.g. *redis.Client
+// Earlier versions declared a three-method interface here; the transport needs consumer groups,
+// scripts and pub/sub, so custom clients now implement redis.UniversalClient or a Transport of their own
+// Scheduled messages need a standalone Redis: *redis.ClusterClient is accepted by the type, but EmitAt
+// is not supported on it, see moveDueScript
+type RedisClient = redis.UniversalClient
+
+const (
+	// scheduledKey is the sorted set of scheduled entry IDs scored by due time in milliseconds
+	scheduledKey = "bus:scheduled"
+	// scheduledEntryPrefix prefixes the hash holding the values of a scheduled entry
+	scheduledEntryPrefix = "bus:scheduled:"
+	// scheduledStreamField is the hash field holding the target stream of a scheduled entry
+	scheduledStreamField = "__stream"
+	// scheduledMaxLenField is the hash field holding the MAXLEN applied when a scheduled entry is moved
+	scheduledMaxLenField = "__maxlen"
+	// parkedKey is the sorted set of due entry IDs their stream rejected, scored by the time they were parked
+	// Their hashes stay under scheduledEntryPrefix with the error in parkedErrorField
+	parkedKey = "bus:scheduled:parked"
+	// parkedErrorField is the hash field holding the XADD error of a parked entry
+	parkedErrorField = "__error"
+
+	// cancelChannel is the pub/sub channel announcing IDs of cancelled requests
+	cancelChannel = "bus:cancel"
+	// cancelledKeyPrefix prefixes the marker key of a cancelled request
+	cancelledKeyPrefix = "bus:cancelled:"
+)
+
+// moveDueScript moves due entries from the sorted set to their streams in one atomic step,
+// so concurrent schedulers never take the same entry and a crashed scheduler never loses one
+// An entry whose XADD fails, e.g. because the stream key holds another type, is parked in KEYS[2]
+// with its hash kept, so it neither aborts the script nor blocks the entries due after it
+// Only the sorted sets are declared in KEYS: entry hashes and target streams are not, and stream names
+// are chosen by users so they cannot carry a hash tag; scheduling therefore requires a standalone Redis
+var moveDueScript = redis.NewScript(`
+local ids = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', ARGV[1], 'LIMIT', 0, tonumber(ARGV[2]))
+local moved, parked = 0, 0
+for _, id in ipairs(ids) do
+	local key = ARGV[3] .. id
+	local fields = redis.call('HGETALL', key)
+	local stream, maxlen = nil, nil
+	local values = {}
+	for i = 1, #fields, 2 do
+		if fields[i] == ARGV[4] then
+			stream = fields[i + 1]
+		elseif fields[i] == ARGV[6] then
+			maxlen = fields[i + 1]
+		else
+			values[#values + 1] = fields[i]
+			values[#values + 1] = fields[i + 1]
+		end
+	end
+	redis.call('ZREM', KEYS[1], id)
+	local added = true
+	if stream and #values > 0 then
+		local res
+		if maxlen then
+			res = redis.pcall('XADD', stream, 'MAXLEN', '~', maxlen, '*', unpack(values))
+		else
+			res = redis.pcall('XADD', stream, '*', unpack(values))
+		end
+		if type(res) == 'table' and res.err then
+			redis.call('HSET', key, ARGV[5], res.err)
+			redis.call('ZADD', KEYS[2], ARGV[1], id)
+			parked = parked + 1
+			added = false
+		else
+			moved = moved + 1
+		end
+	end
+	if added then
+		redis.call('DEL', key)
+	end
+end
+return {moved, parked}
+`)
+
+// RedisTransport implements Transport on top of Redis streams and lists
+type RedisTransport struct {
+	client RedisClient
+}
+
+// NewRedisTransport creates a Transport backed by the Redis client
+func NewRedisTransport(client RedisClient) *RedisTransport {
+	return &RedisTransport{client: client}
+}
+
+// Add appends an entry to the stream with XADD, trimming with MAXLEN ~ when maxLen is set
+func (t *RedisTransport) Add(ctx context.Context, stream string, values map[string]interface{}, maxLen int64) (string, error) {
+	return t.client.XAdd(ctx, &redis.XAddArgs{
+		Stream: stream,
+		Values: values,
+		MaxLen: maxLen,
+		Approx: maxLen > 0,
+	}).Result()
+}
+
+// Delete removes entries from the stream with XDEL
+func (t *RedisTransport) Delete(ctx context.Context, stream string, ids ...string) error {
+	return t.client.XDel(ctx, stream, ids...).Err()
+}
+
+// Trim removes old entries with XTRIM MINID ~
+func (t *RedisTransport) Trim(ctx context.Context, stream, minID string) (int64, error) {
+	return t.client.XTrimMinIDApprox(ctx, stream, minID, 0).Result()
+}
+
+// TrimFloor inspects the consumer groups with XINFO GROUPS and XPENDING
+func (t *RedisTransport) TrimFloor(ctx context.Context, stream string) (string, error) {
+	groups, err := t.client.XInfoGroups(ctx, stream).Result()
+	if err != nil {
+		if strings.Contains(err.Error(), "no such key") {
+			return "", nil
+		}
+		return "", err
+	}
+
+	floor := ""
+	for _, g := range groups {
+		id := g.LastDeliveredID
+		if g.Pending > 0 {
+			pending, err := t.client.XPending(ctx, stream, g.Name).Result()
+			if err != nil {
+				return "", err
+			}
+			id = pending.Lower
+		}
+		floor, err = minStreamID(floor, id)
+		if err != nil {
+			return "", err
+		}
+	}
+	return floor, nil
+}
+
+// Read reads entries after the given ID with XREAD
+// A non-positive block reads without blocking instead of blocking forever
+func (t *RedisTransport) Read(ctx context.Context, stream, after string, count int, block time.Duration) ([]Entry, error) {
+	if block <= 0 {
+		block = -1 // go-redis omits BLOCK for negative values
+	}
+	res, err := t.client.XRead(ctx, &redis.XReadArgs{
+		Streams: []string{stream, after},
+		Count:   int64(count),
+		Block:   block,
+	}).Result()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []Entry
+	for _, s := range res {
+		entries = append(entries, toEntries(s.Messages)...)
+	}
+	return entries, nil
+}
+
+// LastID returns the ID of the last entry with XREVRANGE
+func (t *RedisTransport) LastID(ctx context.Context, stream string) (string, error) {
+	msgs, err := t.client.XRevRangeN(ctx, stream, "+", "-", 1).Result()
+	if err != nil {
+		return "", err
+	}
+	if len(msgs) == 0 {
+		return "0-0", nil
+	}
+	return msgs[0].ID, nil
+}
+
+// CreateGroup creates the consumer group with XGROUP CREATE MKSTREAM, an existing group is not an error
+func (t *RedisTransport) CreateGroup(ctx context.Context, stream, group, start string) error {
+	err := t.client.XGroupCreateMkStream(ctx, stream, group, start).Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return err
+	}
+	return nil
+}
+
+// ReadGroup reads new entries for the consumer with XREADGROUP
+// A non-positive block reads without blocking instead of blocking forever
+func (t *RedisTransport) ReadGroup(ctx context.Context, stream, group, consumer string, count int, block time.Duration) ([]Entry, error) {
+	if block <= 0 {
+		block = -1 // go-redis omits BLOCK for negative values
+	}
+	res, err := t.client.XReadGroup(ctx, &redis.XReadGroupArgs{
+		Group:    group,
+		Consumer: consumer,
+		Streams:  []string{stream, ">"}, // только новые, ещё не доставленные группе
+		Count:    int64(count),
+		Block:    block,
+	}).Result()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// XReadGroup может вернуть массив stream-результатов (обычно 1)
+	var entries []Entry
+	for _, s := range res {
+		entries = append(entries, toEntries(s.Messages)...)
+	}
+	return entries, nil
+}
+
+// GroupLag reads the lag of the group from XINFO GROUPS
+// The raw reply is parsed because XInfoGroups reports a missing lag as 0: Redis before 7.0 has no lag field
+// and later versions reply nil when they cannot compute it, both give -1
+func (t *RedisTransport) GroupLag(ctx context.Context, stream, group string) (int64, error) {
+	groups, err := t.client.Do(ctx, "XINFO", "GROUPS", stream).Slice()
+	if err != nil {
+		return -1, err
+	}
+	for _, g := range groups {
+		fields, err := infoFields(g)
+		if err != nil {
+			return -1, err
+		}
+		if fields["name"] != group {
+			continue
+		}
+		if lag, ok := fields["lag"].(int64); ok {
+			return lag, nil
+		}
+		return -1, nil
+	}
+	return -1, nil
+}
+
+// infoFields converts an XINFO reply entry into a map, it is a map with RESP3 and a flat key-value array with RESP2
+func infoFields(reply interface{}) (map[string]interface{}, error) {
+	fields := make(map[string]interface{})
+	switch v := reply.(type) {
+	case map[interface{}]interface{}:
+		for key, value := range v {
+			if name, ok := key.(string); ok {
+				fields[name] = value
+			}
+		}
+	case []interface{}:
+		for i := 0; i+1 < len(v); i += 2 {
+			if name, ok := v[i].(string); ok {
+				fields[name] = v[i+1]
+			}
+		}
+	default:
+		return nil, fmt.Errorf("unexpected XINFO reply %T", reply)
+	}
+	return fields, nil
+}
+
+// Ack acknowledges entries with XACK
+func (t *RedisTransport) Ack(ctx context.Context, stream, group string, ids ...string) error {
+	return t.client.XAck(ctx, stream, group, ids...).Err()
+}
+
+// Claim takes over idle pending entries with XAUTOCLAIM
+func (t *RedisTransport) Claim(ctx context.Context, stream, group, consumer string, minIdle time.Duration, start string, count int) ([]Entry, string, error) {
+	msgs, next, err := t.client.XAutoClaim(ctx, &redis.XAutoClaimArgs{
+		Stream:   stream,
+		Group:    group,
+		Consumer: consumer,
+		MinIdle:  minIdle,
+		Start:    start,
+		Count:    int64(count),
+	}).Result()
+	if err != nil {
+		return nil, "", err
+	}
+	return toEntries(msgs), next, nil
+}
+
+// Touch resets the idle time of pending entries with XCLAIM JUSTID
+func (t *RedisTransport) Touch(ctx context.Context, stream, group, consumer string, ids ...string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	return t.client.XClaimJustID(ctx, &redis.XClaimArgs{
+		Stream:   stream,
+		Group:    group,
+		Consumer: consumer,
+		Messages: ids,
+	}).Err()
+}
+
+// PushResponse appends the response with RPUSH and sets the list expiry in one pipeline
+func (t *RedisTransport) PushResponse(ctx context.Context, key string, data []byte, ttl time.Duration) error {
+	pipe := t.client.Pipeline()
+	pipe.RPush(ctx, key, data)
+	pipe.Expire(ctx, key, ttl)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// PopResponse waits for the next response with BLPOP
+// BLPOP timeout has one second resolution and zero would block forever, so it is rounded up
+func (t *RedisTransport) PopResponse(ctx context.Context, key string, timeout time.Duration) ([]byte, error) {
+	res, err := t.client.BLPop(ctx, max(timeout, time.Second), key).Result()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// BLPOP returns [key, value]
+	if len(res) != 2 {
+		return nil, errors.New("unexpected BLPOP reply length")
+	}
+	return []byte(res[1]), nil
+}
+
+// CancelRequest sets the marker key of the request and publishes its ID in one transaction
+func (t *RedisTransport) CancelRequest(ctx context.Context, requestID string, ttl time.Duration) error {
+	pipe := t.client.TxPipeline()
+	pipe.Set(ctx, cancelledKeyPrefix+requestID, "1", ttl)
+	pipe.Publish(ctx, cancelChannel, requestID)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// RequestCancelled checks the marker key of the request
+func (t *RedisTransport) RequestCancelled(ctx context.Context, requestID string) (bool, error) {
+	n, err := t.client.Exists(ctx, cancelledKeyPrefix+requestID).Result()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+// WatchCancellations subscribes to the cancellation channel
+// It returns once the subscription is confirmed, so no later cancellation is missed
+func (t *RedisTransport) WatchCancellations(ctx context.Context) (<-chan string, error) {
+	pubsub := t.client.Subscribe(ctx, cancelChannel)
+	if _, err := pubsub.Receive(ctx); err != nil {
+		pubsub.Close()
+		return nil, err
+	}
+
+	ids := make(chan string)
+	go func() {
+		defer close(ids)
+		defer pubsub.Close()
+
+		messages := pubsub.Channel()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case msg, ok := <-messages:
+				if !ok {
+					return
+				}
+				select {
+				case ids <- msg.Payload:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return ids, nil
+}
+
+// Schedule stores the entry values in a hash and adds its ID to the sorted set in one transaction
+func (t *RedisTransport) Schedule(ctx context.Context, stream string, values map[string]interface{}, at time.Time, maxLen int64) error {
+	id := generateRequestID()
+	fields := make(map[string]interface{}, len(values)+2)
+	for k, v := range values {
+		fields[k] = v
+	}
+	fields[scheduledStreamField] = stream
+	if maxLen > 0 {
+		fields[scheduledMaxLenField] = maxLen
+	}
+
+	pipe := t.client.TxPipeline()
+	pipe.HSet(ctx, scheduledEntryPrefix+id, fields)
+	pipe.ZAdd(ctx, scheduledKey, redis.Z{Score: float64(at.UnixMilli()), Member: id})
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// MoveDue moves due entries to their streams with a Lua script
+func (t *RedisTransport) MoveDue(ctx context.Context, now time.Time, count int) (int, int, error) {
+	counts, err := moveDueScript.Run(ctx, t.client,
+		[]string{scheduledKey, parkedKey},
+		now.UnixMilli(), count, scheduledEntryPrefix, scheduledStreamField, parkedErrorField, scheduledMaxLenField,
+	).Int64Slice()
+	if err != nil {
+		return 0, 0, err
+	}
+	if len(counts) != 2 {
+		return 0, 0, fmt.Errorf("unexpected move due reply: %v", counts)
+	}
+	return int(counts[0]), int(counts[1]), nil
+}
+
+// toEntries converts go-redis stream messages to entries
+func toEntries(msgs []redis.XMessage) []Entry {
+	entries := make([]Entry, 0, len(msgs))
+	for _, msg := range msgs {
+		entries = append(entries, Entry{ID: msg.ID, Values: msg.Values})
+	}
+	return entries
+}
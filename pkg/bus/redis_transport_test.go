@@ -0,0 +1,153 @@
+package bus_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/PavelRadostev/toolkit/pkg/bus"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+// newRedis starts an in-process Redis server for the test and returns a client connected to it
+func newRedis(t *testing.T) (*redis.Client, *miniredis.Miniredis) {
+	t.Helper()
+
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+	return client, server
+}
+
+func TestRedisTransportResponsesExpire(t *testing.T) {
+	client, server := newRedis(t)
+	transport := bus.NewRedisTransport(client)
+
+	if err := transport.PushResponse(t.Context(), "resp", []byte("late"), time.Minute); err != nil {
+		t.Fatalf("push: %v", err)
+	}
+	server.FastForward(2 * time.Minute)
+	if data, err := transport.PopResponse(t.Context(), "resp", 10*time.Millisecond); err != nil || data != nil {
+		t.Fatalf("pop an expired response: got %q (%v), want none", data, err)
+	}
+}
+
+func TestRedisTransportCancellationsExpire(t *testing.T) {
+	client, server := newRedis(t)
+	transport := bus.NewRedisTransport(client)
+
+	if err := transport.CancelRequest(t.Context(), "req-1", time.Minute); err != nil {
+		t.Fatalf("cancel: %v", err)
+	}
+	server.FastForward(2 * time.Minute)
+	if ok, err := transport.RequestCancelled(t.Context(), "req-1"); err != nil || ok {
+		t.Fatalf("expired marker: got %v (%v), want false", ok, err)
+	}
+}
+
+func TestRedisTransportWatchClosesWithContext(t *testing.T) {
+	client, _ := newRedis(t)
+	transport := bus.NewRedisTransport(client)
+
+	ctx, cancel := context.WithCancel(t.Context())
+	ids, err := transport.WatchCancellations(ctx)
+	if err != nil {
+		t.Fatalf("watch: %v", err)
+	}
+	cancel()
+
+	select {
+	case _, open := <-ids:
+		if open {
+			t.Fatal("unexpected cancellation after the watch ended")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("channel not closed after ctx was cancelled")
+	}
+}
+
+func TestRedisTransportMoveDueParksRejectedEntries(t *testing.T) {
+	client, _ := newRedis(t)
+	transport := bus.NewRedisTransport(client)
+	ctx := t.Context()
+	now := time.Now()
+
+	// XADD to a key holding a string fails with WRONGTYPE
+	if err := client.Set(ctx, "broken", "not a stream", 0).Err(); err != nil {
+		t.Fatalf("set: %v", err)
+	}
+	if err := transport.Schedule(ctx, "broken", map[string]interface{}{"p": "1"}, now.Add(-2*time.Second), 0); err != nil {
+		t.Fatalf("schedule: %v", err)
+	}
+	if err := transport.Schedule(ctx, "s", map[string]interface{}{"p": "2"}, now.Add(-time.Second), 0); err != nil {
+		t.Fatalf("schedule: %v", err)
+	}
+
+	moved, parked, err := transport.MoveDue(ctx, now, 10)
+	if err != nil || moved != 1 || parked != 1 {
+		t.Fatalf("move due: got %d moved, %d parked (%v), want 1 and 1", moved, parked, err)
+	}
+	if entries, err := transport.Read(ctx, "s", "0-0", 10, 0); err != nil || len(entries) != 1 {
+		t.Fatalf("entry due after the rejected one: got %v (%v), want it moved", entries, err)
+	}
+
+	ids, err := client.ZRange(ctx, "bus:scheduled:parked", 0, -1).Result()
+	if err != nil || len(ids) != 1 {
+		t.Fatalf("parked IDs: got %v (%v)", ids, err)
+	}
+	if cause := client.HGet(ctx, "bus:scheduled:"+ids[0], "__error").Val(); !strings.Contains(cause, "WRONGTYPE") {
+		t.Fatalf("parked error: got %q", cause)
+	}
+	if moved, parked, err := transport.MoveDue(ctx, now, 10); err != nil || moved != 0 || parked != 0 {
+		t.Fatalf("move due again: got %d moved, %d parked (%v), want nothing", moved, parked, err)
+	}
+}
+
+// xinfoClient answers Do with a canned reply, to emulate XINFO GROUPS of servers miniredis does not cover
+type xinfoClient struct {
+	*redis.Client
+	reply interface{}
+}
+
+func (c xinfoClient) Do(ctx context.Context, args ...interface{}) *redis.Cmd {
+	return redis.NewCmdResult(c.reply, nil)
+}
+
+func TestRedisTransportGroupLag(t *testing.T) {
+	for _, protocol := range []int{2, 3} {
+		server := miniredis.RunT(t)
+		client := redis.NewClient(&redis.Options{Addr: server.Addr(), Protocol: protocol})
+		t.Cleanup(func() { client.Close() })
+		transport := bus.NewRedisTransport(client)
+
+		if err := transport.CreateGroup(t.Context(), "s", "g", "$"); err != nil {
+			t.Fatalf("create group: %v", err)
+		}
+		addEntries(t, transport, "s", 2)
+		// miniredis reports the whole stream length as the lag
+		if lag, err := transport.GroupLag(t.Context(), "s", "g"); err != nil || lag != 2 {
+			t.Fatalf("RESP%d lag: got %d (%v), want 2", protocol, lag, err)
+		}
+		if lag, err := transport.GroupLag(t.Context(), "s", "other"); err != nil || lag != -1 {
+			t.Fatalf("RESP%d lag of a missing group: got %d (%v), want -1", protocol, lag, err)
+		}
+	}
+
+	for _, tc := range []struct {
+		name  string
+		reply interface{}
+		want  int64
+	}{
+		{"before 7.0", []interface{}{[]interface{}{"name", "g", "consumers", int64(1), "pending", int64(0), "last-delivered-id", "0-0"}}, -1},
+		{"not computable", []interface{}{map[interface{}]interface{}{"name": "g", "lag": nil}}, -1},
+		{"reported", []interface{}{map[interface{}]interface{}{"name": "g", "lag": int64(7)}}, 7},
+	} {
+		client, _ := newRedis(t)
+		transport := bus.NewRedisTransport(xinfoClient{Client: client, reply: tc.reply})
+		if lag, err := transport.GroupLag(t.Context(), "s", "g"); err != nil || lag != tc.want {
+			t.Fatalf("%s: got %d (%v), want %d", tc.name, lag, err, tc.want)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package bus
+
+import (
+	"strconv"
+	"time"
+)
+
+// DefaultTrimInterval is how often streams with MaxAge are trimmed when no interval is set
+const DefaultTrimInterval = 5 * time.Minute
+
+// RetentionPolicy controls how many stream entries are kept
+// The zero policy keeps every entry
+type RetentionPolicy struct {
+	// MaxLen caps the stream length on every add, approximately (XADD MAXLEN ~)
+	// Entries over the cap are dropped even if a consumer group has not read them yet
+	MaxLen int64
+	// MaxAge trims entries older than this periodically (XTRIM MINID ~)
+	// Entries still pending or undelivered in any consumer group are never trimmed
+	// Streams the bus reads with a cursor are not trimmed
+	MaxAge time.Duration
+	// TrimInterval between periodic trims, DefaultTrimInterval when zero
+	TrimInterval time.Duration
+}
+
+// trimInterval returns the interval between periodic trims
+func (p RetentionPolicy) trimInterval() time.Duration {
+	if p.TrimInterval > 0 {
+		return p.TrimInterval
+	}
+	return DefaultTrimInterval
+}
+
+// SetRetention sets the retention policy of every stream without its own policy
+// It applies both to streams the bus writes to and to streams it consumes
+func (b *Bus) SetRetention(policy RetentionPolicy) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.retention = policy
+}
+
+// SetStreamRetention sets the retention policy of a single stream
+// Producers need it as well as consumers, since MaxLen is applied on add
+func (b *Bus) SetStreamRetention(streamName string, policy RetentionPolicy) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.streamRetention[streamName] = policy
+}
+
+// retentionPolicy returns the retention policy of the stream
+func (b *Bus) retentionPolicy(streamName string) RetentionPolicy {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if policy, ok := b.streamRetention[streamName]; ok {
+		return policy
+	}
+	return b.retention
+}
+
+// deadLetterStreams returns the dead-letter streams of the consumed streams, each once,
+// leaving out those the bus consumes itself since they are trimmed as consumed streams
+func (b *Bus) deadLetterStreams(streams []string) []string {
+	var dlqs []string
+	seen := make(map[string]bool, len(streams))
+	for _, stream := range streams {
+		seen[stream] = true
+	}
+	for _, stream := range streams {
+		policy := b.streamConfig(stream).retry
+		if policy.DisableDeadLetter {
+			continue
+		}
+		dlq := policy.deadLetterStream(stream)
+		if !seen[dlq] {
+			seen[dlq] = true
+			dlqs = append(dlqs, dlq)
+		}
+	}
+	return dlqs
+}
+
+// runTrimmer periodically trims entries older than MaxAge from a consumed stream or a dead-letter stream
+// Streams read with a cursor are not trimmed: stored cursors are not visible in the trim floor,
+// so trimming could drop entries a cursor has not reached yet
+func (b *Bus) runTrimmer(streamName string) {
+	policy := b.retentionPolicy(streamName)
+	if policy.MaxAge <= 0 {
+		return
+	}
+	if b.streamConfig(streamName).cursor != nil {
+		b.log().Warn("MaxAge is not applied to a stream read with a cursor", LogKeyStream, streamName)
+		return
+	}
+
+	ticker := time.NewTicker(policy.trimInterval())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-b.ctx.Done():
+			return
+		case <-ticker.C:
+			b.trim(streamName, policy.MaxAge)
+		}
+	}
+}
+
+// trim removes entries older than maxAge, but never past the oldest entry a consumer group still needs
+func (b *Bus) trim(streamName string, maxAge time.Duration) {
+	minID := strconv.FormatInt(time.Now().Add(-maxAge).UnixMilli(), 10) + "-0"
+
+	floor, err := b.transport.TrimFloor(b.ctx, streamName)
+	if err != nil {
+		if b.ctx.Err() == nil {
+			b.log().Error("Failed to inspect consumer groups", LogKeyStream, streamName, LogKeyError, err)
+		}
+		return
+	}
+	if minID, err = minStreamID(minID, floor); err != nil {
+		b.log().Error("Failed to compute trim point", LogKeyStream, streamName, LogKeyError, err)
+		return
+	}
+
+	trimmed, err := b.transport.Trim(b.ctx, streamName, minID)
+	if err != nil {
+		if b.ctx.Err() == nil {
+			b.log().Error("Failed to trim stream", LogKeyStream, streamName, LogKeyError, err)
+		}
+		return
+	}
+	if trimmed > 0 {
+		b.log().Info("Trimmed stream", LogKeyStream, streamName, "entries", trimmed, "min_id", minID)
+	}
+}
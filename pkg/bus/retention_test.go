@@ -0,0 +1,153 @@
+package bus_test
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/PavelRadostev/toolkit/pkg/bus"
+)
+
+func TestRetentionMaxLenAppliedOnEmit(t *testing.T) {
+	transport := bus.NewMemoryTransport()
+	b := newBus(transport, nil)
+	b.SetStreamRetention("jobs", bus.RetentionPolicy{MaxLen: 3})
+
+	for i := range 5 {
+		if err := b.Emit(t.Context(), job{Stream: "jobs", N: i}); err != nil {
+			t.Fatalf("emit: %v", err)
+		}
+	}
+	entries, err := transport.Read(t.Context(), "jobs", "0-0", 10, 0)
+	if err != nil || len(entries) != 3 {
+		t.Fatalf("entries: got %d (%v), want 3", len(entries), err)
+	}
+}
+
+func TestRetentionMaxAgeKeepsUndeliveredEntries(t *testing.T) {
+	transport := bus.NewMemoryTransport()
+	release := make(chan struct{})
+	factory := bus.NewHandlerFactory()
+	bus.HandleEvent(factory, "jobs", func(ctx context.Context, j job) error {
+		if j.N == 1 {
+			<-release
+		}
+		return nil
+	})
+
+	b := newBus(transport, factory)
+	b.SetRetention(bus.RetentionPolicy{MaxAge: time.Millisecond, TrimInterval: 10 * time.Millisecond})
+	b.Register("jobs", bus.WithBatchSize(1))
+	runBus(t, b, transport, bus.DefaultConsumerGroup, "jobs")
+	defer close(release)
+
+	for i := range 3 {
+		if err := b.Emit(t.Context(), job{Stream: "jobs", N: i}); err != nil {
+			t.Fatalf("emit: %v", err)
+		}
+	}
+	added, err := transport.Read(t.Context(), "jobs", "0-0", 10, 0)
+	if err != nil || len(added) != 3 {
+		t.Fatalf("added entries: got %d (%v), want 3", len(added), err)
+	}
+
+	// The first entry is handled and old enough, the second one is still being handled
+	// and the third one is not delivered yet
+	eventually(t, time.Second, func() bool {
+		entries, err := transport.Read(context.Background(), "jobs", "0-0", 10, 0)
+		return err == nil && len(entries) < 3
+	})
+	time.Sleep(50 * time.Millisecond)
+	entries, err := transport.Read(t.Context(), "jobs", "0-0", 10, 0)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if got, want := entryIDs(entries), entryIDs(added[1:]); !slices.Equal(got, want) {
+		t.Fatalf("entries after trim: got %v, want %v", got, want)
+	}
+}
+
+func TestRetentionMaxAgeSkipsCursorStreams(t *testing.T) {
+	transport := bus.NewMemoryTransport()
+	release := make(chan struct{})
+	factory := bus.NewHandlerFactory()
+	bus.HandleEvent(factory, "jobs", func(ctx context.Context, j job) error {
+		if j.N == 1 {
+			<-release
+		}
+		return nil
+	})
+
+	sender := newBus(transport, nil)
+	for i := range 3 {
+		if err := sender.Emit(t.Context(), job{Stream: "jobs", N: i}); err != nil {
+			t.Fatalf("emit: %v", err)
+		}
+	}
+
+	b := newBus(transport, factory)
+	b.SetRetention(bus.RetentionPolicy{MaxAge: time.Millisecond, TrimInterval: 10 * time.Millisecond})
+	b.Register("jobs", bus.WithCursor("projection", bus.NewMemoryCursorStore()), bus.WithStartPosition(bus.StartEarliest()))
+	done := make(chan error, 1)
+	go func() { done <- b.Run(context.Background()) }()
+	defer func() {
+		close(release)
+		b.Stop()
+		<-done
+	}()
+
+	// The cursor is stuck on the second entry, the trimmer must keep it and the third one
+	time.Sleep(50 * time.Millisecond)
+	entries, err := transport.Read(t.Context(), "jobs", "0-0", 10, 0)
+	if err != nil || len(entries) != 3 {
+		t.Fatalf("entries of a cursor stream: got %d (%v), want all 3 kept", len(entries), err)
+	}
+}
+
+func TestRetentionMaxLenAppliedToScheduledMessages(t *testing.T) {
+	transport := bus.NewMemoryTransport()
+	b := newBus(transport, nil)
+	b.SetStreamRetention("jobs", bus.RetentionPolicy{MaxLen: 3})
+
+	for i := range 5 {
+		if err := b.EmitAt(t.Context(), job{Stream: "jobs", N: i}, time.Now().Add(-time.Second)); err != nil {
+			t.Fatalf("emit at: %v", err)
+		}
+	}
+	if moved, _, err := transport.MoveDue(t.Context(), time.Now(), 10); err != nil || moved != 5 {
+		t.Fatalf("move due: got %d (%v), want 5", moved, err)
+	}
+	entries, err := transport.Read(t.Context(), "jobs", "0-0", 10, 0)
+	if err != nil || len(entries) != 3 {
+		t.Fatalf("entries: got %d (%v), want 3", len(entries), err)
+	}
+}
+
+func TestRetentionMaxAgeTrimsDeadLetterStreams(t *testing.T) {
+	transport := bus.NewMemoryTransport()
+	factory := bus.NewHandlerFactory()
+	for _, stream := range []string{"jobs", "a", "b", "disabled"} {
+		bus.HandleEvent(factory, stream, func(ctx context.Context, j job) error { return nil })
+	}
+	for _, dlq := range []string{"jobs.dlq", "shared.dlq", "disabled.dlq"} {
+		if _, err := transport.Add(t.Context(), dlq, map[string]interface{}{"p": "1"}, 0); err != nil {
+			t.Fatalf("add dead letter: %v", err)
+		}
+	}
+
+	b := newBus(transport, factory)
+	b.SetRetention(bus.RetentionPolicy{MaxAge: time.Millisecond, TrimInterval: 10 * time.Millisecond})
+	b.Register("jobs")
+	b.Register("a", bus.WithRetryPolicy(bus.RetryPolicy{DeadLetterStream: "shared.dlq"}))
+	b.Register("b", bus.WithRetryPolicy(bus.RetryPolicy{DeadLetterStream: "shared.dlq"}))
+	b.Register("disabled", bus.WithRetryPolicy(bus.RetryPolicy{DisableDeadLetter: true}))
+	runBus(t, b, transport, bus.DefaultConsumerGroup, "jobs", "a", "b", "disabled")
+
+	eventually(t, time.Second, func() bool {
+		return len(deadLetters(t, transport, "jobs.dlq")) == 0 && len(deadLetters(t, transport, "shared.dlq")) == 0
+	})
+	if got := deadLetters(t, transport, "disabled.dlq"); len(got) != 1 {
+		t.Fatalf("dead letters of a stream without a dead-letter stream: got %d, want 1 kept", len(got))
+	}
+}
@@ -0,0 +1,178 @@
+package bus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"strconv"
+	"time"
+)
+
+const (
+	// DeadLetterSuffix is appended to the stream name to build the default dead-letter stream
+	DeadLetterSuffix = ".dlq"
+
+	// Failure reasons stored in the dead-letter entry
+	FailureDeserialize   = "deserialize"
+	FailureCreateHandler = "create_handler"
+	FailureHandle        = "handle"
+)
+
+// Dead-letter entry fields added next to the original TransportRequest fields
+const (
+	dlqFieldStream     = "dlq_stream"
+	dlqFieldMessageID  = "dlq_message_id"
+	dlqFieldReason     = "dlq_reason"
+	dlqFieldAttempts   = "dlq_attempts"
+	dlqFieldError      = "dlq_error"
+	dlqFieldErrorClass = "dlq_error_class"
+	dlqFieldFailedAt   = "dlq_failed_at"
+)
+
+// RetryPolicy controls how failed handlers are retried and where poisoned messages go
+type RetryPolicy struct {
+	// MaxAttempts is the total number of Handle calls, values below 1 mean a single attempt
+	MaxAttempts int
+	// InitialBackoff is the delay before the second attempt
+	InitialBackoff time.Duration
+	// MaxBackoff caps the delay between attempts, zero means no cap
+	MaxBackoff time.Duration
+	// Multiplier grows the delay after every attempt, values below 1 mean constant delay
+	Multiplier float64
+	// Jitter randomizes the delay by the given fraction (0.2 means ±20%)
+	Jitter float64
+	// Retryable reports whether the error is worth retrying, nil retries every error
+	Retryable func(err error) bool
+	// DeadLetter reports whether a handler error is stored in the dead-letter stream
+	// nil stores errors nobody was answered about, panics and errors that used up their retries;
+	// an error answered to the caller after a single or non-retryable attempt is the outcome of the request
+	DeadLetter func(err error) bool
+	// DeadLetterStream overrides the default "<stream>.dlq" stream name
+	DeadLetterStream string
+	// DisableDeadLetter drops failed messages instead of storing them
+	DisableDeadLetter bool
+}
+
+// DefaultRetryPolicy returns the policy used for streams without explicit configuration
+// Handlers are called once and failed messages are moved to the dead-letter stream
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:    1,
+		InitialBackoff: 100 * time.Millisecond,
+		MaxBackoff:     10 * time.Second,
+		Multiplier:     2,
+		Jitter:         0.2,
+	}
+}
+
+// shouldRetry reports whether another attempt is allowed after the given one failed
+func (p RetryPolicy) shouldRetry(attempt int, err error) bool {
+	if attempt >= p.MaxAttempts {
+		return false
+	}
+	return p.Retryable == nil || p.Retryable(err)
+}
+
+// shouldDeadLetter reports whether a handler error, after the given number of attempts, is dead-lettered
+func (p RetryPolicy) shouldDeadLetter(req *TransportRequest, attempts int, err error) bool {
+	if p.DeadLetter != nil {
+		return p.DeadLetter(err)
+	}
+	if !req.NeedsResponse() {
+		return true
+	}
+	var panicErr *PanicError
+	if errors.As(err, &panicErr) {
+		return true
+	}
+	return p.MaxAttempts > 1 && attempts >= p.MaxAttempts && (p.Retryable == nil || p.Retryable(err))
+}
+
+// backoff returns the delay before the attempt following the given one
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	delay := float64(p.InitialBackoff)
+	if p.Multiplier > 1 {
+		delay *= math.Pow(p.Multiplier, float64(attempt-1))
+	}
+	if p.MaxBackoff > 0 && delay > float64(p.MaxBackoff) {
+		delay = float64(p.MaxBackoff)
+	}
+	if p.Jitter > 0 {
+		delay *= 1 - p.Jitter + 2*p.Jitter*rand.Float64()
+	}
+	return time.Duration(delay)
+}
+
+// deadLetterStream returns the dead-letter stream name for the source stream
+func (p RetryPolicy) deadLetterStream(streamName string) string {
+	if p.DeadLetterStream != "" {
+		return p.DeadLetterStream
+	}
+	return streamName + DeadLetterSuffix
+}
+
+// handleWithRetry calls Handle until it succeeds or the retry policy gives up
+// A handler that has streamed chunks is not retried, the caller would read them twice
+// Returns the last result, the number of attempts made and the last error
+func (b *Bus) handleWithRetry(ctx context.Context, streamName string, handler HandlerFunc, req *TransportRequest, policy RetryPolicy) (any, int, error) {
+	attempt := 1
+	for {
+		result, err := handler(ctx, req)
+		if err == nil || !policy.shouldRetry(attempt, err) {
+			return result, attempt, err
+		}
+		if chunksSent(ctx) {
+			LoggerFromContext(ctx).Warn("Handler failed after sending response chunks, not retrying",
+				LogKeyAttempt, attempt, LogKeyError, err)
+			return result, attempt, err
+		}
+
+		delay := policy.backoff(attempt)
+		LoggerFromContext(ctx).Warn("Handler failed, retrying",
+			LogKeyAttempt, attempt, "max_attempts", policy.MaxAttempts, "delay", delay, LogKeyError, err)
+		b.metricsSink().MessageRetried(streamName)
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return result, attempt, err
+		case <-timer.C:
+		}
+		attempt++
+	}
+}
+
+// deadLetter stores the original entry fields with the failure details in the dead-letter stream
+func (b *Bus) deadLetter(streamName string, msg Entry, policy RetryPolicy, reason string, attempts int, cause error) error {
+	if policy.DisableDeadLetter {
+		return nil
+	}
+
+	values := make(map[string]interface{}, len(msg.Values)+7)
+	for k, v := range msg.Values {
+		values[k] = v
+	}
+	values[dlqFieldStream] = streamName
+	values[dlqFieldMessageID] = msg.ID
+	values[dlqFieldReason] = reason
+	values[dlqFieldAttempts] = strconv.Itoa(attempts)
+	values[dlqFieldError] = cause.Error()
+	values[dlqFieldErrorClass] = b.errorRegistry().Class(cause)
+	values[dlqFieldFailedAt] = strconv.FormatFloat(float64(time.Now().UnixNano())/1e9, 'f', -1, 64)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	dlq := policy.deadLetterStream(streamName)
+	if _, err := b.transport.Add(ctx, dlq, values, b.retentionPolicy(dlq).MaxLen); err != nil {
+		return fmt.Errorf("failed to add message to dead-letter stream %s: %w", dlq, err)
+	}
+
+	b.log().Warn("Moved message to dead-letter stream",
+		LogKeyStream, streamName, LogKeyRedisMessageID, msg.ID, "dead_letter_stream", dlq,
+		"reason", reason, LogKeyAttempt, attempts, LogKeyError, cause)
+	return nil
+}
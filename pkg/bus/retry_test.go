@@ -0,0 +1,139 @@
+package bus_test
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/PavelRadostev/toolkit/pkg/bus"
+)
+
+// deadLetters returns the entries of the dead-letter stream
+func deadLetters(t *testing.T, transport bus.Transport, stream string) []bus.Entry {
+	t.Helper()
+
+	entries, err := transport.Read(context.Background(), stream, "0-0", 100, 0)
+	if err != nil {
+		t.Fatalf("read %s: %v", stream, err)
+	}
+	return entries
+}
+
+// failingBus runs a bus whose "jobs" handler fails with err and counts the calls
+func failingBus(t *testing.T, transport *bus.MemoryTransport, policy bus.RetryPolicy, err error) *atomic.Int32 {
+	t.Helper()
+
+	var calls atomic.Int32
+	factory := bus.NewHandlerFactory()
+	bus.Handle(factory, "jobs", func(ctx context.Context, j job) (int, error) {
+		calls.Add(1)
+		if err == nil {
+			panic("boom")
+		}
+		return 0, err
+	})
+	b := newBus(transport, factory)
+	b.Register("jobs", bus.WithRetryPolicy(policy))
+	runBus(t, b, transport, bus.DefaultConsumerGroup, "jobs")
+	return &calls
+}
+
+func TestAnsweredErrorIsNotDeadLettered(t *testing.T) {
+	transport := bus.NewMemoryTransport()
+	failingBus(t, transport, bus.DefaultRetryPolicy(), bus.ErrNotFound)
+
+	_, err := bus.Call[job, int](t.Context(), newBus(transport, nil), job{Stream: "jobs"})
+	if !errors.Is(err, bus.ErrNotFound) {
+		t.Fatalf("call: got %v, want ErrNotFound", err)
+	}
+	eventually(t, time.Second, func() bool {
+		return len(pendingIDs(t, transport, "jobs", bus.DefaultConsumerGroup)) == 0
+	})
+	if entries := deadLetters(t, transport, "jobs.dlq"); len(entries) != 0 {
+		t.Fatalf("answered error was dead-lettered: %v", entries)
+	}
+}
+
+func TestUnansweredErrorIsDeadLettered(t *testing.T) {
+	transport := bus.NewMemoryTransport()
+	failingBus(t, transport, bus.DefaultRetryPolicy(), bus.ErrNotFound)
+
+	if err := newBus(transport, nil).Emit(t.Context(), job{Stream: "jobs"}); err != nil {
+		t.Fatalf("emit: %v", err)
+	}
+	eventually(t, time.Second, func() bool { return len(deadLetters(t, transport, "jobs.dlq")) == 1 })
+
+	entry := deadLetters(t, transport, "jobs.dlq")[0]
+	if got := entry.Values["dlq_reason"]; got != bus.FailureHandle {
+		t.Fatalf("dlq_reason: got %v", got)
+	}
+	if got := entry.Values["dlq_error_class"]; got != "NotFoundError" {
+		t.Fatalf("dlq_error_class: got %v", got)
+	}
+}
+
+func TestPanicIsDeadLettered(t *testing.T) {
+	transport := bus.NewMemoryTransport()
+	failingBus(t, transport, bus.DefaultRetryPolicy(), nil)
+
+	_, err := bus.Call[job, int](t.Context(), newBus(transport, nil), job{Stream: "jobs"})
+	var panicErr *bus.PanicError
+	if !errors.As(err, &panicErr) {
+		t.Fatalf("call: got %v, want *PanicError", err)
+	}
+	eventually(t, time.Second, func() bool { return len(deadLetters(t, transport, "jobs.dlq")) == 1 })
+}
+
+func TestExhaustedRetriesAreDeadLettered(t *testing.T) {
+	transport := bus.NewMemoryTransport()
+	policy := bus.RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond}
+	calls := failingBus(t, transport, policy, errors.New("database unavailable"))
+
+	if _, err := bus.Call[job, int](t.Context(), newBus(transport, nil), job{Stream: "jobs"}); err == nil {
+		t.Fatal("call: expected the handler error")
+	}
+	eventually(t, time.Second, func() bool { return len(deadLetters(t, transport, "jobs.dlq")) == 1 })
+	if got := calls.Load(); got != 3 {
+		t.Fatalf("attempts: got %d, want 3", got)
+	}
+	if got := deadLetters(t, transport, "jobs.dlq")[0].Values["dlq_attempts"]; got != "3" {
+		t.Fatalf("dlq_attempts: got %v", got)
+	}
+}
+
+func TestNonRetryableAnsweredErrorIsNotDeadLettered(t *testing.T) {
+	transport := bus.NewMemoryTransport()
+	policy := bus.RetryPolicy{
+		MaxAttempts:    3,
+		InitialBackoff: time.Millisecond,
+		Retryable:      func(err error) bool { return !errors.Is(err, bus.ErrValidation) },
+	}
+	calls := failingBus(t, transport, policy, bus.ErrValidation)
+
+	if _, err := bus.Call[job, int](t.Context(), newBus(transport, nil), job{Stream: "jobs"}); !errors.Is(err, bus.ErrValidation) {
+		t.Fatalf("call: got %v, want ErrValidation", err)
+	}
+	eventually(t, time.Second, func() bool {
+		return len(pendingIDs(t, transport, "jobs", bus.DefaultConsumerGroup)) == 0
+	})
+	if got := calls.Load(); got != 1 {
+		t.Fatalf("attempts: got %d, want 1", got)
+	}
+	if entries := deadLetters(t, transport, "jobs.dlq"); len(entries) != 0 {
+		t.Fatalf("non-retryable answered error was dead-lettered: %v", entries)
+	}
+}
+
+func TestDeadLetterPredicate(t *testing.T) {
+	transport := bus.NewMemoryTransport()
+	policy := bus.DefaultRetryPolicy()
+	policy.DeadLetter = func(err error) bool { return errors.Is(err, bus.ErrNotFound) }
+	failingBus(t, transport, policy, bus.ErrNotFound)
+
+	if _, err := bus.Call[job, int](t.Context(), newBus(transport, nil), job{Stream: "jobs"}); !errors.Is(err, bus.ErrNotFound) {
+		t.Fatalf("call: got %v, want ErrNotFound", err)
+	}
+	eventually(t, time.Second, func() bool { return len(deadLetters(t, transport, "jobs.dlq")) == 1 })
+}
@@ -0,0 +1,107 @@
+package bus
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+const (
+	// DefaultSchedulerInterval is how often Run moves due scheduled messages to their streams
+	DefaultSchedulerInterval = time.Second
+
+	// scheduleBatchSize is the maximum number of scheduled messages moved per transport call
+	scheduleBatchSize = 100
+)
+
+// EmitAt sends a message to be handled at the given time, without waiting for a response
+// The message is parked in the transport and moved to its stream by the scheduler of any running Bus
+// With RedisTransport this requires a standalone Redis, Redis Cluster is not supported
+func (b *Bus) EmitAt(ctx context.Context, pub Publisher, at time.Time, opts ...CallOption) error {
+	options := newCallOptions(ctx, false, opts)
+
+	transportReq, err := newRequest(pub, options)
+	if err != nil {
+		return err
+	}
+
+	send := b.publishChain(func(ctx context.Context, streamName string, req *TransportRequest) (Response, error) {
+		return Response{}, b.schedule(ctx, streamName, req, at)
+	})
+	_, err = send(ctx, pub.String(), transportReq)
+	return err
+}
+
+// EmitAfter sends a message to be handled after the delay, without waiting for a response
+func (b *Bus) EmitAfter(ctx context.Context, pub Publisher, delay time.Duration, opts ...CallOption) error {
+	return b.EmitAt(ctx, pub, time.Now().Add(delay), opts...)
+}
+
+// SetSchedulerInterval sets how often Run moves due scheduled messages to their streams
+// Zero or a negative value disables the scheduler on this Bus
+func (b *Bus) SetSchedulerInterval(interval time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.scheduleInterval = interval
+}
+
+// schedule serializes the TransportRequest and parks it in the transport until at
+func (b *Bus) schedule(ctx context.Context, streamName string, req *TransportRequest, at time.Time) (err error) {
+	span := b.startPublishSpan(ctx, streamName, "schedule", req)
+	defer func() { span.End(err) }()
+
+	values, err := b.serializer.Serialize(req)
+	if err != nil {
+		return fmt.Errorf("failed to serialize transport request: %w", err)
+	}
+
+	if err := b.transport.Schedule(ctx, streamName, values, at, b.retentionPolicy(streamName).MaxLen); err != nil {
+		return fmt.Errorf("failed to schedule message: %w", err)
+	}
+
+	b.log().Debug("Scheduled message", LogKeyStream, streamName, LogKeyRequestID, req.RequestID, "at", at)
+	return nil
+}
+
+// runScheduler moves due scheduled messages to their streams until the bus stops
+// Every replica runs it, the transport hands each message to one of them
+func (b *Bus) runScheduler(interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-b.ctx.Done():
+			return
+		case <-ticker.C:
+			b.moveDue()
+		}
+	}
+}
+
+// moveDue moves every message that is due now, batch by batch
+func (b *Bus) moveDue() {
+	now := time.Now()
+	for {
+		moved, parked, err := b.transport.MoveDue(b.ctx, now, scheduleBatchSize)
+		if err != nil {
+			if b.ctx.Err() == nil {
+				b.log().Error("Failed to move scheduled messages", LogKeyError, err)
+			}
+			return
+		}
+		if moved > 0 {
+			b.log().Debug("Moved scheduled messages to their streams", "moved", moved)
+		}
+		if parked > 0 {
+			b.log().Error("Parked scheduled messages rejected by their streams", "parked", parked)
+		}
+		if moved+parked < scheduleBatchSize {
+			return
+		}
+	}
+}
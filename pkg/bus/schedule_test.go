@@ -0,0 +1,45 @@
+package bus_test
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/PavelRadostev/toolkit/pkg/bus"
+)
+
+func TestEmitAfterDeliversOnceAcrossReplicas(t *testing.T) {
+	transport := bus.NewMemoryTransport()
+	var handled atomic.Int32
+	if err := transport.CreateGroup(t.Context(), "jobs", bus.DefaultConsumerGroup, "$"); err != nil {
+		t.Fatalf("create group: %v", err)
+	}
+	// Two replicas of one service run the scheduler against the same transport
+	for _, consumer := range []string{"first", "second"} {
+		factory := bus.NewHandlerFactory()
+		bus.HandleEvent(factory, "jobs", func(ctx context.Context, j job) error {
+			handled.Add(1)
+			return nil
+		})
+		b := newBus(transport, factory)
+		b.SetConsumerGroup(bus.DefaultConsumerGroup, consumer)
+		b.SetSchedulerInterval(10 * time.Millisecond)
+		runBus(t, b, transport, bus.DefaultConsumerGroup)
+	}
+
+	if err := newBus(transport, nil).EmitAfter(t.Context(), job{Stream: "jobs", N: 1}, 100*time.Millisecond); err != nil {
+		t.Fatalf("emit after: %v", err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if got := handled.Load(); got != 0 {
+		t.Fatalf("handled before the delay: %d", got)
+	}
+
+	eventually(t, time.Second, func() bool { return handled.Load() == 1 })
+	// Leave time for a duplicate to show up
+	time.Sleep(50 * time.Millisecond)
+	if got := handled.Load(); got != 1 {
+		t.Fatalf("handled: got %d, want 1", got)
+	}
+}
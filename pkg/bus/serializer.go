@@ -22,7 +22,7 @@ type RedisBrokerSerialize struct {
 // NewRedisBrokerSerialize creates a new RedisBrokerSerialize instance
 func NewRedisBrokerSerialize() *RedisBrokerSerialize {
 	return &RedisBrokerSerialize{
-		requiredAttrs: []string{"i", "r", "p"},
+		requiredAttrs: []string{FieldRequestID, FieldReturnResult, FieldProperties},
 	}
 }
 
@@ -31,19 +31,25 @@ func (s *RedisBrokerSerialize) Serialize(request *TransportRequest) (map[string]
 	result := make(map[string]interface{})
 
 	// Required fields
-	result["i"] = request.RequestID
-	result["r"] = strconv.Itoa(request.ReturnResult)
-	result["p"] = string(request.Properties)
+	result[FieldRequestID] = request.RequestID
+	result[FieldReturnResult] = strconv.Itoa(request.ReturnResult)
+	result[FieldProperties] = string(request.Properties)
 
 	// Optional fields
 	if len(request.Message) > 0 {
-		result["m"] = string(request.Message)
+		result[FieldMessage] = string(request.Message)
 	}
 	if request.Timeout > 0 {
-		result["t"] = strconv.Itoa(request.Timeout)
+		result[FieldTimeout] = strconv.Itoa(request.Timeout)
 	}
 	if request.CreatedTimestamp > 0 {
-		result["c"] = strconv.FormatFloat(request.CreatedTimestamp, 'f', -1, 64)
+		result[FieldCreatedTimestamp] = strconv.FormatFloat(request.CreatedTimestamp, 'f', -1, 64)
+	}
+	if len(request.TraceContext) > 0 {
+		result[FieldTraceContext] = string(request.TraceContext)
+	}
+	if request.StreamResponse {
+		result[FieldStreamResponse] = "1"
 	}
 
 	return result, nil
@@ -59,7 +65,7 @@ func (s *RedisBrokerSerialize) Deserialize(messageData map[string]interface{}) (
 	req := &TransportRequest{}
 
 	// Extract RequestID ("i") - required
-	if val, ok := messageData["i"]; ok {
+	if val, ok := messageData[FieldRequestID]; ok {
 		v, ok := val.(string)
 		if !ok {
 			return nil, fmt.Errorf("invalid RequestID type: %T, expected string", val)
@@ -68,7 +74,7 @@ func (s *RedisBrokerSerialize) Deserialize(messageData map[string]interface{}) (
 	}
 
 	// Extract ReturnResult ("r") - required, string only
-	if val, ok := messageData["r"]; ok {
+	if val, ok := messageData[FieldReturnResult]; ok {
 		v, ok := val.(string)
 		if !ok {
 			return nil, fmt.Errorf("invalid ReturnResult type: %T, expected string", val)
@@ -81,7 +87,7 @@ func (s *RedisBrokerSerialize) Deserialize(messageData map[string]interface{}) (
 	}
 
 	// Extract Properties ("p") - required
-	if val, ok := messageData["p"]; ok {
+	if val, ok := messageData[FieldProperties]; ok {
 		switch v := val.(type) {
 		case []byte:
 			req.Properties = v
@@ -93,7 +99,7 @@ func (s *RedisBrokerSerialize) Deserialize(messageData map[string]interface{}) (
 	}
 
 	// Extract Message ("m") - optional, string only
-	if val, ok := messageData["m"]; ok {
+	if val, ok := messageData[FieldMessage]; ok {
 		v, ok := val.(string)
 		if !ok {
 			return nil, fmt.Errorf("invalid Message type: %T, expected string", val)
@@ -102,7 +108,7 @@ func (s *RedisBrokerSerialize) Deserialize(messageData map[string]interface{}) (
 	}
 
 	// Extract Timeout ("t") - optional, string only
-	if val, ok := messageData["t"]; ok {
+	if val, ok := messageData[FieldTimeout]; ok {
 		v, ok := val.(string)
 		if !ok {
 			return nil, fmt.Errorf("invalid Timeout type: %T, expected string", val)
@@ -117,7 +123,7 @@ func (s *RedisBrokerSerialize) Deserialize(messageData map[string]interface{}) (
 	}
 
 	// Extract CreatedTimestamp ("c") - optional, string only
-	if val, ok := messageData["c"]; ok {
+	if val, ok := messageData[FieldCreatedTimestamp]; ok {
 		v, ok := val.(string)
 		if !ok {
 			return nil, fmt.Errorf("invalid CreatedTimestamp type: %T, expected string", val)
@@ -129,6 +135,21 @@ func (s *RedisBrokerSerialize) Deserialize(messageData map[string]interface{}) (
 		req.CreatedTimestamp = timestamp
 	}
 
+	// Extract StreamResponse ("s") - optional, an unexpected type is ignored like an unknown field
+	if v, ok := messageData[FieldStreamResponse].(string); ok {
+		req.StreamResponse = v == "1"
+	}
+
+	// Extract TraceContext ("h") - optional, an unexpected type is ignored like an unknown field
+	if val, ok := messageData[FieldTraceContext]; ok {
+		switch v := val.(type) {
+		case string:
+			req.TraceContext = []byte(v)
+		case []byte:
+			req.TraceContext = v
+		}
+	}
+
 	return req, nil
 }
 
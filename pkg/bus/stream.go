@@ -0,0 +1,68 @@
+package bus
+
+// StreamOption configures how the Bus consumes a single stream
+type StreamOption func(*streamConfig)
+
+// streamConfig holds per-stream consumer settings
+type streamConfig struct {
+	retry     RetryPolicy
+	workers   int
+	batchSize int
+	inbox     Inbox
+	start     StartPosition
+	// cursor is set for streams read without a consumer group
+	cursorName string
+	cursor     CursorStore
+}
+
+// defaultStreamConfig returns the settings used for streams registered without options
+func defaultStreamConfig() streamConfig {
+	return streamConfig{
+		retry:   DefaultRetryPolicy(),
+		workers: 1,
+	}
+}
+
+// WithRetryPolicy sets the retry and dead-letter policy for the stream
+func WithRetryPolicy(policy RetryPolicy) StreamOption {
+	return func(c *streamConfig) {
+		c.retry = policy
+	}
+}
+
+// WithWorkers sets the number of entries of the stream handled concurrently
+func WithWorkers(n int) StreamOption {
+	return func(c *streamConfig) {
+		if n > 0 {
+			c.workers = n
+		}
+	}
+}
+
+// WithBatchSize caps the number of entries fetched by a single read
+// By default the bus reads as many entries as there are free workers
+func WithBatchSize(n int) StreamOption {
+	return func(c *streamConfig) {
+		if n > 0 {
+			c.batchSize = n
+		}
+	}
+}
+
+// readLimit returns the maximum number of entries fetched by a single read
+func (c streamConfig) readLimit() int {
+	if c.batchSize > 0 {
+		return min(c.batchSize, c.workers)
+	}
+	return c.workers
+}
+
+// streamConfig returns the settings registered for the stream or the defaults
+func (b *Bus) streamConfig(streamName string) streamConfig {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if cfg, ok := b.streams[streamName]; ok {
+		return cfg
+	}
+	return defaultStreamConfig()
+}
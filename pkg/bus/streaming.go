@@ -0,0 +1,127 @@
+package bus
+
+import (
+	"context"
+	"fmt"
+	"iter"
+	"sync/atomic"
+	"time"
+)
+
+type chunkWriterKey struct{}
+
+// chunkWriter pushes intermediate results of a request to its response list
+type chunkWriter struct {
+	bus       *Bus
+	requestID string
+	// sent is set once a chunk reached the caller, the handler is not retried after that
+	sent atomic.Bool
+}
+
+// contextWithChunkWriter returns a context through which the handler streams chunks of the request
+func (b *Bus) contextWithChunkWriter(ctx context.Context, req *TransportRequest) context.Context {
+	return context.WithValue(ctx, chunkWriterKey{}, &chunkWriter{bus: b, requestID: req.RequestID})
+}
+
+// Streaming reports whether the caller of the handled request reads chunks sent with SendChunk
+func Streaming(ctx context.Context) bool {
+	_, ok := ctx.Value(chunkWriterKey{}).(*chunkWriter)
+	return ok
+}
+
+// SendChunk sends an intermediate result to the caller before the handler returns
+// It does nothing when the caller did not ask for a streamed response, e.g. waits with Execute
+func SendChunk(ctx context.Context, value any) error {
+	w, ok := ctx.Value(chunkWriterKey{}).(*chunkWriter)
+	if !ok {
+		return nil
+	}
+
+	transportResp := TransportResponse{
+		ReqID:  w.requestID,
+		Result: value,
+		More:   true,
+	}
+	data, err := transportResp.Encode()
+	if err != nil {
+		return fmt.Errorf("failed to encode response chunk: %w", err)
+	}
+	if err := w.bus.transport.PushResponse(ctx, w.requestID, data, responseTTL); err != nil {
+		return fmt.Errorf("failed to write response chunk: %w", err)
+	}
+	w.sent.Store(true)
+	LoggerFromContext(ctx).Debug("Sent response chunk")
+	return nil
+}
+
+// chunksSent reports whether the handler has already streamed chunks of the request to the caller
+func chunksSent(ctx context.Context) bool {
+	w, ok := ctx.Value(chunkWriterKey{}).(*chunkWriter)
+	return ok && w.sent.Load()
+}
+
+// ExecuteStream sends a request and yields the chunks sent by the handler with SendChunk, then its final response
+// The request is sent when the iteration starts; breaking out of the loop cancels the handler like a cancelled ctx
+// A failure to send or to read ends the sequence with the error, handler errors come in Response.Error
+func (b *Bus) ExecuteStream(ctx context.Context, pub Publisher, opts ...CallOption) iter.Seq2[Response, error] {
+	return func(yield func(Response, error) bool) {
+		options := newCallOptions(ctx, true, opts)
+
+		transportReq, err := newRequest(pub, options)
+		if err != nil {
+			yield(Response{}, err)
+			return
+		}
+		transportReq.StreamResponse = true
+
+		// Publish middleware sees only the publish, the chunks are read below
+		var sent *TransportRequest
+		send := b.publishChain(func(ctx context.Context, streamName string, req *TransportRequest) (Response, error) {
+			if err := b.add(ctx, streamName, req); err != nil {
+				return Response{}, err
+			}
+			sent = req
+			return Response{}, nil
+		})
+		streamName := pub.String()
+		resp, err := send(ctx, streamName, transportReq)
+		if err != nil || sent == nil {
+			// A response stubbed by middleware is the whole stream
+			yield(resp, err)
+			return
+		}
+		if !sent.NeedsResponse() {
+			return
+		}
+
+		waitCtx, span := b.tracing().Start(ctx, streamName+" wait", SpanKindInternal, spanAttributes(streamName, "wait", sent)...)
+		var waitErr error
+		defer func() { span.End(waitErr) }()
+
+		deadline := time.Now().Add(options.timeout)
+		for {
+			transportResp, err := b.waitTransportResponse(waitCtx, sent.RequestID, deadline)
+			if err != nil {
+				waitErr = err
+				if ctx.Err() != nil {
+					// Nobody waits for the result anymore, let the handler stop early
+					b.cancelRequest(ctx, streamName, sent)
+				}
+				yield(Response{}, err)
+				return
+			}
+
+			resp := transportResp.ResponseWith(b.errorRegistry())
+			if !transportResp.More {
+				waitErr = resp.Error
+				yield(resp, nil)
+				return
+			}
+			if !yield(resp, nil) {
+				// The caller stopped reading before the final response
+				b.cancelRequest(ctx, streamName, sent)
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package bus_test
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/PavelRadostev/toolkit/pkg/bus"
+	"github.com/PavelRadostev/toolkit/pkg/bus/bustest"
+)
+
+// countdown asks the handler to stream N chunks before its result
+type countdown struct {
+	N int `cbor:"n"`
+}
+
+func (countdown) String() string { return "countdown" }
+
+// streamingBus runs a bus serving "countdown" with the handler and the retry policy
+func streamingBus(t *testing.T, policy bus.RetryPolicy, handle func(ctx context.Context, q countdown) (int, error)) *bus.Bus {
+	t.Helper()
+
+	transport := bus.NewMemoryTransport()
+	factory := bus.NewHandlerFactory()
+	bus.Handle(factory, "countdown", handle)
+	b := newBus(transport, factory)
+	b.Register("countdown", bus.WithRetryPolicy(policy))
+	runBus(t, b, transport, bus.DefaultConsumerGroup, "countdown")
+	return b
+}
+
+// collect reads the whole stream, returning the values and the first error
+func collect(ctx context.Context, b *bus.Bus, q countdown) ([]int, error) {
+	var values []int
+	for v, err := range bus.CallStream[countdown, int](ctx, b, q) {
+		if err != nil {
+			return values, err
+		}
+		values = append(values, v)
+	}
+	return values, nil
+}
+
+func TestCallStreamYieldsChunksThenResult(t *testing.T) {
+	var streaming atomic.Bool
+	b := streamingBus(t, bus.DefaultRetryPolicy(), func(ctx context.Context, q countdown) (int, error) {
+		streaming.Store(bus.Streaming(ctx))
+		for i := range q.N {
+			if err := bus.SendChunk(ctx, i); err != nil {
+				return 0, err
+			}
+		}
+		if q.N < 0 {
+			return 0, errors.New("negative count")
+		}
+		return 100, nil
+	})
+
+	got, err := collect(t.Context(), b, countdown{N: 3})
+	if err != nil || !slices.Equal(got, []int{0, 1, 2, 100}) || !streaming.Load() {
+		t.Fatalf("stream: got %v (%v), streaming %v", got, err, streaming.Load())
+	}
+
+	// Call waits for the result only, the handler does not stream
+	result, err := bus.Call[countdown, int](t.Context(), b, countdown{N: 3})
+	if err != nil || result != 100 || streaming.Load() {
+		t.Fatalf("call: got %d (%v), streaming %v", result, err, streaming.Load())
+	}
+
+	if got, err := collect(t.Context(), b, countdown{N: -1}); err == nil || len(got) != 0 {
+		t.Fatalf("failed handler: got %v (%v), want the handler error", got, err)
+	}
+}
+
+func TestCallStreamBreakCancelsHandler(t *testing.T) {
+	causes := make(chan error, 1)
+	b := streamingBus(t, bus.DefaultRetryPolicy(), func(ctx context.Context, q countdown) (int, error) {
+		for i := range q.N {
+			if err := bus.SendChunk(ctx, i); err != nil {
+				return 0, err
+			}
+			select {
+			case <-ctx.Done():
+				causes <- context.Cause(ctx)
+				return 0, ctx.Err()
+			case <-time.After(10 * time.Millisecond):
+			}
+		}
+		return 0, nil
+	})
+
+	read := 0
+	for _, err := range bus.CallStream[countdown, int](t.Context(), b, countdown{N: 1000}) {
+		if err != nil {
+			t.Fatalf("chunk: %v", err)
+		}
+		if read++; read == 3 {
+			break
+		}
+	}
+
+	select {
+	case cause := <-causes:
+		if !errors.Is(cause, bus.ErrRequestCancelled) {
+			t.Fatalf("handler context cause: got %v, want ErrRequestCancelled", cause)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("handler not cancelled after the caller stopped reading")
+	}
+}
+
+func TestStreamingHandlerIsNotRetriedAfterChunks(t *testing.T) {
+	var calls atomic.Int32
+	policy := bus.RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond}
+	b := streamingBus(t, policy, func(ctx context.Context, q countdown) (int, error) {
+		// The first attempt fails before streaming and is retried, the second one fails after a chunk
+		if calls.Add(1) == 1 {
+			return 0, errors.New("not ready")
+		}
+		if err := bus.SendChunk(ctx, 1); err != nil {
+			return 0, err
+		}
+		return 0, errors.New("broken halfway")
+	})
+
+	got, err := collect(t.Context(), b, countdown{N: 1})
+	if err == nil || !slices.Equal(got, []int{1}) {
+		t.Fatalf("stream: got %v (%v), want a single chunk and the handler error", got, err)
+	}
+	if n := calls.Load(); n != 2 {
+		t.Fatalf("handler calls: got %d, want 2", n)
+	}
+}
+
+func TestCallStreamStubbedByRecorder(t *testing.T) {
+	b := bustest.NewBus(t, nil)
+	b.Recorder.Stub("countdown", bus.Response{Data: 7})
+
+	got, err := collect(t.Context(), b.Bus, countdown{N: 3})
+	if err != nil || !slices.Equal(got, []int{7}) {
+		t.Fatalf("stubbed stream: got %v (%v), want the stubbed 7 only", got, err)
+	}
+}
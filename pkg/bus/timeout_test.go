@@ -0,0 +1,100 @@
+package bus_test
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/PavelRadostev/toolkit/pkg/bus"
+)
+
+// backdate makes the requests sent by the bus look created d ago, so their deadline comes sooner
+// than the caller stops waiting
+func backdate(b *bus.Bus, d time.Duration) {
+	b.UsePublish(func(next bus.PublishFunc) bus.PublishFunc {
+		return func(ctx context.Context, streamName string, req *bus.TransportRequest) (bus.Response, error) {
+			req.CreatedTimestamp -= d.Seconds()
+			return next(ctx, streamName, req)
+		}
+	})
+}
+
+func TestExpiredRequestIsAnsweredWithTimeout(t *testing.T) {
+	transport := bus.NewMemoryTransport()
+	var calls atomic.Int32
+	factory := bus.NewHandlerFactory()
+	bus.Handle(factory, "jobs", func(ctx context.Context, j job) (int, error) {
+		calls.Add(1)
+		return 1, nil
+	})
+	b := newBus(transport, factory)
+	b.Register("jobs")
+	runBus(t, b, transport, bus.DefaultConsumerGroup, "jobs")
+
+	req, err := bus.NewRequest(job{Stream: "jobs", N: 1}, bus.WithReturnResult(true), bus.WithTimeout(time.Second))
+	if err != nil {
+		t.Fatalf("new request: %v", err)
+	}
+	req.CreatedTimestamp -= 2
+	if err := b.EmitRequest(t.Context(), "jobs", req); err != nil {
+		t.Fatalf("emit request: %v", err)
+	}
+
+	data, err := transport.PopResponse(t.Context(), req.RequestID, 2*time.Second)
+	if err != nil || data == nil {
+		t.Fatalf("pop response: got %q (%v)", data, err)
+	}
+	resp, err := bus.DecodeTransportResponse(data)
+	if err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if resp.ErrorClass != "TimeoutError" || !errors.Is(resp.Response().Error, bus.ErrRequestTimeout) {
+		t.Fatalf("response: got class %q, error %v, want TimeoutError", resp.ErrorClass, resp.Response().Error)
+	}
+	if got := calls.Load(); got != 0 {
+		t.Fatalf("handler calls: got %d, want the expired request skipped", got)
+	}
+	if got := deadLetters(t, transport, "jobs.dlq"); len(got) != 0 {
+		t.Fatalf("dead letters: got %d, want none", len(got))
+	}
+}
+
+func TestHandlerDeadlineFollowsRequestTimeout(t *testing.T) {
+	transport := bus.NewMemoryTransport()
+	handlerErrs := make(chan error, 1)
+	factory := bus.NewHandlerFactory()
+	bus.Handle(factory, "jobs", func(ctx context.Context, j job) (int, error) {
+		<-ctx.Done()
+		handlerErrs <- ctx.Err()
+		return 0, ctx.Err()
+	})
+	b := newBus(transport, factory)
+	b.Register("jobs")
+	runBus(t, b, transport, bus.DefaultConsumerGroup, "jobs")
+
+	// The request deadline passes after about 200ms while the caller waits for a second
+	caller := newBus(transport, nil)
+	backdate(caller, 800*time.Millisecond)
+	started := time.Now()
+	_, err := bus.Call[job, int](t.Context(), caller, job{Stream: "jobs", N: 1}, bus.WithTimeout(time.Second))
+	if !errors.Is(err, bus.ErrRequestTimeout) {
+		t.Fatalf("call: got %v, want ErrRequestTimeout", err)
+	}
+	if elapsed := time.Since(started); elapsed > 700*time.Millisecond {
+		t.Fatalf("call returned after %v, want the consumer answer at the request deadline", elapsed)
+	}
+
+	select {
+	case err := <-handlerErrs:
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("handler context: got %v, want the deadline exceeded", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("handler context not cancelled at the request deadline")
+	}
+	if got := deadLetters(t, transport, "jobs.dlq"); len(got) != 0 {
+		t.Fatalf("dead letters: got %d, want none", len(got))
+	}
+}
@@ -0,0 +1,216 @@
+package bus
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+// W3C trace context headers carried in FieldTraceContext
+const (
+	HeaderTraceParent = "traceparent"
+	HeaderTraceState  = "tracestate"
+	HeaderBaggage     = "baggage"
+)
+
+// traceEncMode encodes trace carriers with sorted keys, so equal carriers produce equal bytes
+var traceEncMode = sync.OnceValues(func() (cbor.EncMode, error) {
+	return cbor.CoreDetEncOptions().EncMode()
+})
+
+// TraceCarrier holds the trace context headers of a request: traceparent, tracestate and baggage
+// It implements the OpenTelemetry propagation.TextMapCarrier interface, so OTel propagators
+// can inject into and extract from it directly
+type TraceCarrier map[string]string
+
+// Get returns the value of the header
+func (c TraceCarrier) Get(key string) string {
+	return c[key]
+}
+
+// Set stores the value of the header
+func (c TraceCarrier) Set(key, value string) {
+	c[key] = value
+}
+
+// Keys lists the stored headers
+func (c TraceCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for key := range c {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// Encode encodes the carrier into the CBOR map sent in FieldTraceContext
+func (c TraceCarrier) Encode() ([]byte, error) {
+	em, err := traceEncMode()
+	if err != nil {
+		return nil, err
+	}
+	return em.Marshal(map[string]string(c))
+}
+
+// TraceCarrier decodes the trace context headers of the request, nil when the request carries none
+func (r *TransportRequest) TraceCarrier() (TraceCarrier, error) {
+	if len(r.TraceContext) == 0 {
+		return nil, nil
+	}
+	var carrier TraceCarrier
+	if err := cbor.Unmarshal(r.TraceContext, &carrier); err != nil {
+		return nil, err
+	}
+	return carrier, nil
+}
+
+type traceCarrierKey struct{}
+
+// ContextWithTraceCarrier returns a context carrying trace context headers
+// Without a Tracer the bus forwards these headers as is, e.g. those received by an HTTP gateway
+func ContextWithTraceCarrier(ctx context.Context, carrier TraceCarrier) context.Context {
+	return context.WithValue(ctx, traceCarrierKey{}, carrier)
+}
+
+// TraceCarrierFromContext returns the trace context headers stored in ctx
+// Handlers see the headers of the request they handle
+func TraceCarrierFromContext(ctx context.Context) (TraceCarrier, bool) {
+	carrier, ok := ctx.Value(traceCarrierKey{}).(TraceCarrier)
+	return carrier, ok
+}
+
+// SpanKind is the role of a span, values match the OpenTelemetry trace.SpanKind constants
+type SpanKind int
+
+// Span kinds used by the bus
+const (
+	SpanKindInternal SpanKind = 1
+	SpanKindProducer SpanKind = 4
+	SpanKindConsumer SpanKind = 5
+)
+
+// SpanAttribute is a span attribute following the OpenTelemetry messaging conventions
+type SpanAttribute struct {
+	Key   string
+	Value string
+}
+
+// Span is a started span
+type Span interface {
+	// End finishes the span, a non-nil err marks it as failed
+	End(err error)
+}
+
+// Tracer creates spans and propagates trace context through requests
+// It mirrors the OpenTelemetry Tracer and TextMapPropagator, so an adapter is a thin wrapper around them
+type Tracer interface {
+	// Start starts a span as a child of the span in ctx and returns a context holding it
+	Start(ctx context.Context, name string, kind SpanKind, attrs ...SpanAttribute) (context.Context, Span)
+	// Inject writes the trace context of ctx into the carrier
+	Inject(ctx context.Context, carrier TraceCarrier)
+	// Extract returns ctx with the trace context read from the carrier
+	Extract(ctx context.Context, carrier TraceCarrier) context.Context
+}
+
+// propagationTracer forwards trace context headers stored with ContextWithTraceCarrier and records no spans
+type propagationTracer struct{}
+
+func (propagationTracer) Start(ctx context.Context, _ string, _ SpanKind, _ ...SpanAttribute) (context.Context, Span) {
+	return ctx, nopSpan{}
+}
+
+func (propagationTracer) Inject(ctx context.Context, carrier TraceCarrier) {
+	stored, _ := TraceCarrierFromContext(ctx)
+	for key, value := range stored {
+		carrier.Set(key, value)
+	}
+}
+
+func (propagationTracer) Extract(ctx context.Context, carrier TraceCarrier) context.Context {
+	if len(carrier) == 0 {
+		return ctx
+	}
+	return ContextWithTraceCarrier(ctx, carrier)
+}
+
+// nopSpan is a span that records nothing
+type nopSpan struct{}
+
+func (nopSpan) End(error) {}
+
+// SetTracer sets the Tracer used for spans and trace context propagation
+// nil restores the default, which only forwards headers stored with ContextWithTraceCarrier
+func (b *Bus) SetTracer(tracer Tracer) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if tracer == nil {
+		tracer = propagationTracer{}
+	}
+	b.tracer = tracer
+}
+
+// tracing returns the configured Tracer
+func (b *Bus) tracing() Tracer {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.tracer
+}
+
+// spanAttributes returns the messaging attributes of a span for the request
+func spanAttributes(streamName, operation string, req *TransportRequest) []SpanAttribute {
+	return []SpanAttribute{
+		{Key: "messaging.system", Value: "redis"},
+		{Key: "messaging.destination.name", Value: streamName},
+		{Key: "messaging.operation", Value: operation},
+		{Key: "messaging.message.id", Value: req.RequestID},
+	}
+}
+
+// startPublishSpan starts the producer span of a request and injects its trace context into the request
+// A request that already carries trace context, e.g. a prepared one passed to EmitRequest, keeps it
+func (b *Bus) startPublishSpan(ctx context.Context, streamName, operation string, req *TransportRequest) Span {
+	tracer := b.tracing()
+	ctx, span := tracer.Start(ctx, streamName+" "+operation, SpanKindProducer, spanAttributes(streamName, operation, req)...)
+	if err := req.InjectTraceContext(ctx, tracer); err != nil {
+		// Trace context is advisory, the message is sent without it
+		b.log().Warn("Failed to encode trace context", LogKeyStream, streamName, LogKeyRequestID, req.RequestID, LogKeyError, err)
+	}
+	return span
+}
+
+// InjectTraceContext writes the trace context of ctx into the request, unless it already carries one
+// A nil tracer forwards headers stored with ContextWithTraceCarrier, like a Bus without SetTracer
+// Use it for requests built with NewRequest and sent later, so they keep the trace of the code that built them
+func (r *TransportRequest) InjectTraceContext(ctx context.Context, tracer Tracer) error {
+	if len(r.TraceContext) > 0 {
+		return nil
+	}
+	if tracer == nil {
+		tracer = propagationTracer{}
+	}
+
+	carrier := TraceCarrier{}
+	tracer.Inject(ctx, carrier)
+	if len(carrier) == 0 {
+		return nil
+	}
+	data, err := carrier.Encode()
+	if err != nil {
+		return fmt.Errorf("failed to encode trace context: %w", err)
+	}
+	r.TraceContext = data
+	return nil
+}
+
+// startHandleSpan extracts the trace context of a consumed request and starts its consumer span
+func (b *Bus) startHandleSpan(ctx context.Context, streamName string, req *TransportRequest) (context.Context, Span) {
+	tracer := b.tracing()
+	if carrier, err := req.TraceCarrier(); err != nil {
+		// Trace context is advisory, a malformed value must not block the message
+		LoggerFromContext(ctx).Warn("Failed to decode trace context", LogKeyError, err)
+	} else {
+		ctx = tracer.Extract(ctx, carrier)
+	}
+	return tracer.Start(ctx, streamName+" process", SpanKindConsumer, spanAttributes(streamName, "process", req)...)
+}
@@ -0,0 +1,155 @@
+package bus_test
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/PavelRadostev/toolkit/pkg/bus"
+	"github.com/PavelRadostev/toolkit/pkg/bus/bustest"
+)
+
+// spanKey is the context key of the name of the current test span
+type spanKey struct{}
+
+// recordingTracer propagates span names through the "traceparent" header and records started spans
+type recordingTracer struct {
+	mu    sync.Mutex
+	spans []string
+}
+
+func (r *recordingTracer) Start(ctx context.Context, name string, _ bus.SpanKind, _ ...bus.SpanAttribute) (context.Context, bus.Span) {
+	parent, _ := ctx.Value(spanKey{}).(string)
+	r.mu.Lock()
+	r.spans = append(r.spans, name+" <- "+parent)
+	r.mu.Unlock()
+	return context.WithValue(ctx, spanKey{}, name), noSpan{}
+}
+
+func (r *recordingTracer) Inject(ctx context.Context, carrier bus.TraceCarrier) {
+	if name, ok := ctx.Value(spanKey{}).(string); ok {
+		carrier.Set(bus.HeaderTraceParent, name)
+	}
+}
+
+func (r *recordingTracer) Extract(ctx context.Context, carrier bus.TraceCarrier) context.Context {
+	if name := carrier.Get(bus.HeaderTraceParent); name != "" {
+		return context.WithValue(ctx, spanKey{}, name)
+	}
+	return ctx
+}
+
+// started returns the recorded spans as "name <- parent"
+func (r *recordingTracer) started() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return slices.Clone(r.spans)
+}
+
+// noSpan ends without recording anything
+type noSpan struct{}
+
+func (noSpan) End(error) {}
+
+// traced is a message the trace tests call
+type traced struct{}
+
+func (traced) String() string { return "traced" }
+
+func TestTraceHeadersPassThroughWithoutTracer(t *testing.T) {
+	factory := bus.NewHandlerFactory()
+	bus.Handle(factory, "traced", func(ctx context.Context, _ traced) (string, error) {
+		carrier, _ := bus.TraceCarrierFromContext(ctx)
+		return carrier.Get(bus.HeaderTraceParent) + "|" + carrier.Get(bus.HeaderBaggage), nil
+	})
+	b := bustest.NewBus(t, factory)
+
+	ctx := bus.ContextWithTraceCarrier(t.Context(), bus.TraceCarrier{
+		bus.HeaderTraceParent: "00-abc-def-01",
+		bus.HeaderBaggage:     "tenant=1",
+	})
+	got, err := bus.Call[traced, string](ctx, b.Bus, traced{})
+	if err != nil || got != "00-abc-def-01|tenant=1" {
+		t.Fatalf("forwarded headers: got %q (%v)", got, err)
+	}
+
+	got, err = bus.Call[traced, string](t.Context(), b.Bus, traced{})
+	if err != nil || got != "|" {
+		t.Fatalf("headers without trace context: got %q (%v), want none", got, err)
+	}
+}
+
+func TestTracerLinksProducerAndConsumerSpans(t *testing.T) {
+	factory := bus.NewHandlerFactory()
+	bus.Handle(factory, "traced", func(ctx context.Context, _ traced) (string, error) {
+		name, _ := ctx.Value(spanKey{}).(string)
+		return name, nil
+	})
+	b := bustest.NewBus(t, factory)
+	tracer := &recordingTracer{}
+	b.SetTracer(tracer)
+
+	got, err := bus.Call[traced, string](t.Context(), b.Bus, traced{})
+	if err != nil || got != "traced process" {
+		t.Fatalf("handler span: got %q (%v), want traced process", got, err)
+	}
+	spans := tracer.started()
+	if !slices.Contains(spans, "traced process <- traced publish") {
+		t.Fatalf("consumer span is not a child of the producer span: %v", spans)
+	}
+}
+
+func TestInjectTraceContext(t *testing.T) {
+	ctx := bus.ContextWithTraceCarrier(t.Context(), bus.TraceCarrier{bus.HeaderTraceParent: "00-abc-def-01"})
+	req, err := bus.NewRequest(job{Stream: "jobs", N: 1})
+	if err != nil {
+		t.Fatalf("new request: %v", err)
+	}
+	if err := req.InjectTraceContext(ctx, nil); err != nil {
+		t.Fatalf("inject: %v", err)
+	}
+	if carrier, err := req.TraceCarrier(); err != nil || carrier.Get(bus.HeaderTraceParent) != "00-abc-def-01" {
+		t.Fatalf("injected headers: got %v (%v)", carrier, err)
+	}
+
+	// A request keeps the trace context it already carries
+	other := bus.ContextWithTraceCarrier(t.Context(), bus.TraceCarrier{bus.HeaderTraceParent: "00-other-01"})
+	if err := req.InjectTraceContext(other, nil); err != nil {
+		t.Fatalf("inject again: %v", err)
+	}
+	if carrier, _ := req.TraceCarrier(); carrier.Get(bus.HeaderTraceParent) != "00-abc-def-01" {
+		t.Fatalf("headers after a second inject: got %v, want the first ones", carrier)
+	}
+}
+
+func TestPreparedRequestContinuesTraceOfItsBuilder(t *testing.T) {
+	transport := bus.NewMemoryTransport()
+	factory := bus.NewHandlerFactory()
+	bus.HandleEvent(factory, "jobs", func(ctx context.Context, j job) error {
+		return nil
+	})
+	b := newBus(transport, factory)
+	tracer := &recordingTracer{}
+	b.SetTracer(tracer)
+	b.Register("jobs")
+	runBus(t, b, transport, bus.DefaultConsumerGroup, "jobs")
+
+	// Built within the span of a transaction, sent later from another context like the outbox relay does
+	txCtx, _ := tracer.Start(t.Context(), "transaction", bus.SpanKindInternal)
+	req, err := bus.NewRequest(job{Stream: "jobs", N: 1})
+	if err != nil {
+		t.Fatalf("new request: %v", err)
+	}
+	if err := req.InjectTraceContext(txCtx, tracer); err != nil {
+		t.Fatalf("inject: %v", err)
+	}
+	if err := b.EmitRequest(t.Context(), "jobs", req); err != nil {
+		t.Fatalf("emit request: %v", err)
+	}
+
+	eventually(t, time.Second, func() bool {
+		return slices.Contains(tracer.started(), "jobs process <- transaction")
+	})
+}
@@ -2,15 +2,17 @@ package bus
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/fxamacker/cbor/v2"
-	"github.com/redis/go-redis/v9"
 )
 
 // TransportRequest represents a CQRS transport request from Python
 // Serialized using CBOR with short keys to match Python's TransportRequest class
 type TransportRequest struct {
 	RedisMessageID string `cbor:"id"`
+	// Stream the request was read from, set by the consumer and never sent over the wire
+	Stream string `cbor:"-"`
 	// Created timestamp in Unix epoch format (e.g., 1714214741.926557)
 	CreatedTimestamp float64 `cbor:"c"`
 	// Request ID - hex string UUID (e.g., "8a55d93256964d0dbc2173e70b75bf2f")
@@ -23,6 +25,10 @@ type TransportRequest struct {
 	ReturnResult int `cbor:"r"`
 	// Timeout in seconds
 	Timeout int `cbor:"t"`
+	// TraceContext - CBOR-encoded map of W3C trace context headers (optional)
+	TraceContext []byte `cbor:"h,omitempty"`
+	// StreamResponse - true when the caller reads intermediate chunks with ExecuteStream
+	StreamResponse bool `cbor:"s,omitempty"`
 }
 
 // TransportResponse represents a CQRS transport response to Python
@@ -36,6 +42,12 @@ type TransportResponse struct {
 	Error string `cbor:"error,omitempty"`
 	// Error class name (optional)
 	ErrorClass string `cbor:"error_class,omitempty"`
+	// Structured error details (optional, ignored by callers that do not know them)
+	ErrorDetails map[string]any `cbor:"error_details,omitempty"`
+	// More marks an intermediate chunk of a streamed response, the final response has it unset
+	More bool `cbor:"more,omitempty"`
+	// rawResult keeps the CBOR-encoded result of a decoded response
+	rawResult []byte
 }
 
 // DecodeTransportRequest decodes a CBOR-encoded TransportRequest
@@ -47,6 +59,63 @@ func DecodeTransportRequest(data []byte) (*TransportRequest, error) {
 	return &req, nil
 }
 
+// Encode encodes the TransportRequest to CBOR, the inverse of DecodeTransportRequest
+func (r *TransportRequest) Encode() ([]byte, error) {
+	return cbor.Marshal(r)
+}
+
+// rawTransportResponse mirrors TransportResponse but keeps Result undecoded
+type rawTransportResponse struct {
+	ReqID        string          `cbor:"req_id"`
+	Result       cbor.RawMessage `cbor:"result,omitempty"`
+	Error        string          `cbor:"error,omitempty"`
+	ErrorClass   string          `cbor:"error_class,omitempty"`
+	ErrorDetails map[string]any  `cbor:"error_details,omitempty"`
+	More         bool            `cbor:"more,omitempty"`
+}
+
+// DecodeTransportResponse decodes a CBOR-encoded TransportResponse
+func DecodeTransportResponse(data []byte) (*TransportResponse, error) {
+	var raw rawTransportResponse
+	if err := cbor.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+
+	resp := &TransportResponse{
+		ReqID:        raw.ReqID,
+		Error:        raw.Error,
+		ErrorClass:   raw.ErrorClass,
+		ErrorDetails: raw.ErrorDetails,
+		More:         raw.More,
+		rawResult:    raw.Result,
+	}
+	if len(raw.Result) > 0 {
+		if err := cbor.Unmarshal(raw.Result, &resp.Result); err != nil {
+			return nil, fmt.Errorf("failed to decode result: %w", err)
+		}
+	}
+	return resp, nil
+}
+
+// Response converts the TransportResponse into a Response for the caller
+// Errors are reconstructed with DefaultErrors
+func (r *TransportResponse) Response() Response {
+	return r.ResponseWith(DefaultErrors)
+}
+
+// ResponseWith converts the TransportResponse into a Response for the caller
+// Errors are reconstructed with the given registry
+func (r *TransportResponse) ResponseWith(registry *ErrorRegistry) Response {
+	response := Response{
+		Data:   r.Result,
+		result: r.rawResult,
+	}
+	if r.Error != "" || r.ErrorClass != "" {
+		response.Error = registry.Reconstruct(r.ErrorClass, r.Error, r.ErrorDetails)
+	}
+	return response
+}
+
 // Encode encodes the TransportResponse to CBOR
 func (r *TransportResponse) Encode() ([]byte, error) {
 	return cbor.Marshal(r)
@@ -73,6 +142,16 @@ func (r *TransportRequest) NeedsResponse() bool {
 	return r.ReturnResult == 1
 }
 
+// Deadline returns the moment the caller stops waiting for the response
+// Returns false when the request has no creation timestamp or timeout
+func (r *TransportRequest) Deadline() (time.Time, bool) {
+	if r.CreatedTimestamp <= 0 || r.Timeout <= 0 {
+		return time.Time{}, false
+	}
+	created := time.Unix(0, int64(r.CreatedTimestamp*1e9))
+	return created.Add(time.Duration(r.Timeout) * time.Second), true
+}
+
 // EncodeResult encodes any result value to CBOR bytes for TransportResponse
 func EncodeResult(result any) ([]byte, error) {
 	if result == nil {
@@ -80,107 +159,3 @@ func EncodeResult(result any) ([]byte, error) {
 	}
 	return cbor.Marshal(result)
 }
-
-// extractTransportRequest extracts TransportRequest from Redis message
-// Supports two formats:
-// 1. CBOR-encoded data in "data" field (Go-to-Go messages)
-// 2. Individual fields in msg.Values: "r", "p", "m", "t", "c" (Python messages)
-// RequestID is extracted from msg.ID (Redis message ID)
-func extractTransportRequest(msg redis.XMessage) (*TransportRequest, error) {
-	// Try format 1: CBOR-encoded data in "data" field
-	if dataRaw, ok := msg.Values["data"]; ok {
-		var data []byte
-		switch v := dataRaw.(type) {
-		case string:
-			data = []byte(v)
-		case []byte:
-			data = v
-		default:
-			return nil, fmt.Errorf("invalid data type: %T", dataRaw)
-		}
-		transportReq, err := DecodeTransportRequest(data)
-		if err != nil {
-			return nil, err
-		}
-		// Override RequestID with Redis message ID
-		transportReq.RequestID = msg.ID
-		return transportReq, nil
-	}
-
-	// Format 2: Individual fields directly in msg.Values
-	req := &TransportRequest{}
-
-	// Extract RequestID from Redis message ID
-	req.RedisMessageID = msg.ID
-
-	// Extract RequestID ("i") - string only
-	if val, ok := msg.Values["i"]; ok {
-		v, ok := val.(string)
-		if !ok {
-			return nil, fmt.Errorf("invalid RequestID type: %T, expected string", val)
-		}
-		req.RequestID = v
-	}
-
-	// Extract ReturnResult ("r") - string only
-	if val, ok := msg.Values["r"]; ok {
-		v, ok := val.(string)
-		if !ok {
-			return nil, fmt.Errorf("invalid ReturnResult type: %T, expected string", val)
-		}
-		var result int
-		if _, err := fmt.Sscanf(v, "%d", &result); err != nil {
-			return nil, fmt.Errorf("invalid ReturnResult string format: %q", v)
-		}
-		req.ReturnResult = result
-	}
-
-	// Extract Properties ("p")
-	if val, ok := msg.Values["p"]; ok {
-		switch v := val.(type) {
-		case []byte:
-			req.Properties = v
-		case string:
-			req.Properties = []byte(v)
-		default:
-			return nil, fmt.Errorf("invalid Properties type: %T", val)
-		}
-	}
-
-	// Extract Message ("m") - string only
-	if val, ok := msg.Values["m"]; ok {
-		v, ok := val.(string)
-		if !ok {
-			return nil, fmt.Errorf("invalid Message type: %T, expected string", val)
-		}
-		req.Message = []byte(v)
-	}
-
-	// Extract Timeout ("t") - string only
-	if val, ok := msg.Values["t"]; ok {
-		v, ok := val.(string)
-		if !ok {
-			return nil, fmt.Errorf("invalid Timeout type: %T, expected string", val)
-		}
-		var timeout int
-		if _, err := fmt.Sscanf(v, "%d", &timeout); err != nil {
-			return nil, fmt.Errorf("invalid Timeout string format: %q", v)
-		}
-		req.Timeout = timeout
-	}
-
-	// Extract CreatedTimestamp ("c") - string only
-	if val, ok := msg.Values["c"]; ok {
-		v, ok := val.(string)
-		if !ok {
-			return nil, fmt.Errorf("invalid CreatedTimestamp type: %T, expected string", val)
-		}
-		var timestamp float64
-		if _, err := fmt.Sscanf(v, "%f", &timestamp); err != nil {
-			return nil, fmt.Errorf("invalid CreatedTimestamp string format: %q", v)
-		}
-		req.CreatedTimestamp = timestamp
-	}
-
-	return req, nil
-}
@@ -0,0 +1,311 @@
+package bus_test
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/PavelRadostev/toolkit/pkg/bus"
+)
+
+// forEachTransport runs the test against a fresh MemoryTransport and a fresh RedisTransport,
+// so both implementations keep the behaviour Bus relies on
+func forEachTransport(t *testing.T, test func(t *testing.T, transport bus.Transport)) {
+	t.Run("memory", func(t *testing.T) {
+		test(t, bus.NewMemoryTransport())
+	})
+	t.Run("redis", func(t *testing.T) {
+		client, _ := newRedis(t)
+		test(t, bus.NewRedisTransport(client))
+	})
+}
+
+// entryIDs returns the IDs of the entries
+func entryIDs(entries []bus.Entry) []string {
+	ids := make([]string, 0, len(entries))
+	for _, e := range entries {
+		ids = append(ids, e.ID)
+	}
+	return ids
+}
+
+// addEntries appends n entries with an "n" field to the stream and returns their IDs
+func addEntries(t *testing.T, transport bus.Transport, stream string, n int) []string {
+	t.Helper()
+
+	ids := make([]string, 0, n)
+	for i := range n {
+		id, err := transport.Add(context.Background(), stream, map[string]interface{}{"n": i}, 0)
+		if err != nil {
+			t.Fatalf("add to %s: %v", stream, err)
+		}
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+func TestTransportStream(t *testing.T) {
+	forEachTransport(t, func(t *testing.T, transport bus.Transport) {
+		ctx := t.Context()
+		if id, err := transport.LastID(ctx, "s"); err != nil || id != "0-0" {
+			t.Fatalf("last ID of a missing stream: got %q (%v), want 0-0", id, err)
+		}
+
+		ids := addEntries(t, transport, "s", 3)
+		if id, err := transport.LastID(ctx, "s"); err != nil || id != ids[2] {
+			t.Fatalf("last ID: got %q (%v), want %s", id, err, ids[2])
+		}
+
+		entries, err := transport.Read(ctx, "s", ids[0], 10, 0)
+		if err != nil {
+			t.Fatalf("read: %v", err)
+		}
+		if got := entryIDs(entries); !slices.Equal(got, ids[1:]) {
+			t.Fatalf("read after the first entry: got %v, want %v", got, ids[1:])
+		}
+		// Values come back as strings, whatever type they were added with
+		if got := entries[0].Values["n"]; got != "1" {
+			t.Fatalf("value: got %#v, want \"1\"", got)
+		}
+
+		if entries, err := transport.Read(ctx, "s", ids[2], 10, 10*time.Millisecond); err != nil || len(entries) != 0 {
+			t.Fatalf("read past the end: got %v (%v), want a timeout without entries", entries, err)
+		}
+
+		if err := transport.Delete(ctx, "s", ids[1]); err != nil {
+			t.Fatalf("delete: %v", err)
+		}
+		entries, err = transport.Read(ctx, "s", "0-0", 10, 0)
+		if err != nil {
+			t.Fatalf("read after delete: %v", err)
+		}
+		if got, want := entryIDs(entries), []string{ids[0], ids[2]}; !slices.Equal(got, want) {
+			t.Fatalf("read after delete: got %v, want %v", got, want)
+		}
+	})
+}
+
+func TestTransportReadBlocksUntilAdd(t *testing.T) {
+	forEachTransport(t, func(t *testing.T, transport bus.Transport) {
+		go func() {
+			time.Sleep(20 * time.Millisecond)
+			addEntries(t, transport, "s", 1)
+		}()
+
+		entries, err := transport.Read(t.Context(), "s", "0-0", 10, 2*time.Second)
+		if err != nil || len(entries) != 1 {
+			t.Fatalf("blocking read: got %v (%v), want the added entry", entries, err)
+		}
+	})
+}
+
+func TestTransportConsumerGroup(t *testing.T) {
+	forEachTransport(t, func(t *testing.T, transport bus.Transport) {
+		ctx := t.Context()
+		for range 2 {
+			if err := transport.CreateGroup(ctx, "s", "g", "$"); err != nil {
+				t.Fatalf("create group twice: %v", err)
+			}
+		}
+		ids := addEntries(t, transport, "s", 3)
+
+		entries, err := transport.ReadGroup(ctx, "s", "g", "c", 2, 0)
+		if err != nil {
+			t.Fatalf("read group: %v", err)
+		}
+		if got := entryIDs(entries); !slices.Equal(got, ids[:2]) {
+			t.Fatalf("read group: got %v, want %v", got, ids[:2])
+		}
+		if err := transport.Ack(ctx, "s", "g", ids[0]); err != nil {
+			t.Fatalf("ack: %v", err)
+		}
+		if got := pendingIDs(t, transport, "s", "g"); !slices.Equal(got, ids[1:2]) {
+			t.Fatalf("pending after ack: got %v, want %v", got, ids[1:2])
+		}
+
+		entries, err = transport.ReadGroup(ctx, "s", "g", "c", 10, 10*time.Millisecond)
+		if err != nil {
+			t.Fatalf("read group: %v", err)
+		}
+		if got := entryIDs(entries); !slices.Equal(got, ids[2:]) {
+			t.Fatalf("second read group: got %v, want %v", got, ids[2:])
+		}
+		if entries, err := transport.ReadGroup(ctx, "s", "g", "c", 10, 10*time.Millisecond); err != nil || len(entries) != 0 {
+			t.Fatalf("read group past the end: got %v (%v), want a timeout without entries", entries, err)
+		}
+	})
+}
+
+func TestTransportClaimAndTouch(t *testing.T) {
+	forEachTransport(t, func(t *testing.T, transport bus.Transport) {
+		ctx := t.Context()
+		if err := transport.CreateGroup(ctx, "s", "g", "$"); err != nil {
+			t.Fatalf("create group: %v", err)
+		}
+		ids := addEntries(t, transport, "s", 1)
+		if _, err := transport.ReadGroup(ctx, "s", "g", "first", 1, 0); err != nil {
+			t.Fatalf("read group: %v", err)
+		}
+
+		const minIdle = 30 * time.Millisecond
+		if entries, _, err := transport.Claim(ctx, "s", "g", "second", minIdle, "0-0", 10); err != nil || len(entries) != 0 {
+			t.Fatalf("claim a fresh entry: got %v (%v), want none", entries, err)
+		}
+
+		time.Sleep(2 * minIdle)
+		if err := transport.Touch(ctx, "s", "g", "first", ids...); err != nil {
+			t.Fatalf("touch: %v", err)
+		}
+		if entries, _, err := transport.Claim(ctx, "s", "g", "second", minIdle, "0-0", 10); err != nil || len(entries) != 0 {
+			t.Fatalf("claim a touched entry: got %v (%v), want none", entries, err)
+		}
+
+		time.Sleep(2 * minIdle)
+		entries, next, err := transport.Claim(ctx, "s", "g", "second", minIdle, "0-0", 10)
+		if err != nil {
+			t.Fatalf("claim: %v", err)
+		}
+		if got := entryIDs(entries); !slices.Equal(got, ids) || next != "0-0" {
+			t.Fatalf("claim an idle entry: got %v with cursor %q, want %v with 0-0", got, next, ids)
+		}
+	})
+}
+
+func TestTransportTrim(t *testing.T) {
+	forEachTransport(t, func(t *testing.T, transport bus.Transport) {
+		ctx := t.Context()
+		addEntries(t, transport, "nogroups", 1)
+		if floor, err := transport.TrimFloor(ctx, "nogroups"); err != nil || floor != "" {
+			t.Fatalf("floor of a stream without groups: got %q (%v), want empty", floor, err)
+		}
+
+		if err := transport.CreateGroup(ctx, "s", "g", "$"); err != nil {
+			t.Fatalf("create group: %v", err)
+		}
+		ids := addEntries(t, transport, "s", 4)
+		if _, err := transport.ReadGroup(ctx, "s", "g", "c", 2, 0); err != nil {
+			t.Fatalf("read group: %v", err)
+		}
+		if err := transport.Ack(ctx, "s", "g", ids[0]); err != nil {
+			t.Fatalf("ack: %v", err)
+		}
+
+		floor, err := transport.TrimFloor(ctx, "s")
+		if err != nil || floor != ids[1] {
+			t.Fatalf("floor: got %q (%v), want the oldest pending entry %s", floor, err, ids[1])
+		}
+		if _, err := transport.Trim(ctx, "s", floor); err != nil {
+			t.Fatalf("trim: %v", err)
+		}
+		entries, err := transport.Read(ctx, "s", "0-0", 10, 0)
+		if err != nil {
+			t.Fatalf("read: %v", err)
+		}
+		if got := entryIDs(entries); !slices.Equal(got, ids[1:]) {
+			t.Fatalf("entries after trim: got %v, want %v", got, ids[1:])
+		}
+	})
+}
+
+func TestTransportResponses(t *testing.T) {
+	forEachTransport(t, func(t *testing.T, transport bus.Transport) {
+		ctx := t.Context()
+		for _, data := range []string{"first", "second"} {
+			if err := transport.PushResponse(ctx, "resp", []byte(data), time.Minute); err != nil {
+				t.Fatalf("push: %v", err)
+			}
+		}
+		for _, want := range []string{"first", "second"} {
+			data, err := transport.PopResponse(ctx, "resp", time.Second)
+			if err != nil || string(data) != want {
+				t.Fatalf("pop: got %q (%v), want %q", data, err, want)
+			}
+		}
+		if data, err := transport.PopResponse(ctx, "resp", 10*time.Millisecond); err != nil || data != nil {
+			t.Fatalf("pop from an empty list: got %q (%v), want a timeout without data", data, err)
+		}
+	})
+}
+
+func TestTransportCancellations(t *testing.T) {
+	forEachTransport(t, func(t *testing.T, transport bus.Transport) {
+		ctx := t.Context()
+		ids, err := transport.WatchCancellations(ctx)
+		if err != nil {
+			t.Fatalf("watch: %v", err)
+		}
+		if err := transport.CancelRequest(ctx, "req-1", time.Minute); err != nil {
+			t.Fatalf("cancel: %v", err)
+		}
+
+		select {
+		case id := <-ids:
+			if id != "req-1" {
+				t.Fatalf("watched ID: got %q, want req-1", id)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("cancellation not delivered to the watcher")
+		}
+		if ok, err := transport.RequestCancelled(ctx, "req-1"); err != nil || !ok {
+			t.Fatalf("cancelled request: got %v (%v), want true", ok, err)
+		}
+		if ok, err := transport.RequestCancelled(ctx, "req-2"); err != nil || ok {
+			t.Fatalf("other request: got %v (%v), want false", ok, err)
+		}
+	})
+}
+
+func TestTransportSchedule(t *testing.T) {
+	forEachTransport(t, func(t *testing.T, transport bus.Transport) {
+		ctx := t.Context()
+		now := time.Now()
+		payload := string([]byte{0xa1, 0x00, 0xff})
+		if err := transport.Schedule(ctx, "s", map[string]interface{}{"p": payload}, now.Add(-time.Second), 0); err != nil {
+			t.Fatalf("schedule a due entry: %v", err)
+		}
+		if err := transport.Schedule(ctx, "s", map[string]interface{}{"p": "later"}, now.Add(time.Hour), 0); err != nil {
+			t.Fatalf("schedule a future entry: %v", err)
+		}
+
+		if moved, parked, err := transport.MoveDue(ctx, now, 10); err != nil || moved != 1 || parked != 0 {
+			t.Fatalf("move due: got %d moved, %d parked (%v), want 1 moved", moved, parked, err)
+		}
+		if moved, _, err := transport.MoveDue(ctx, now, 10); err != nil || moved != 0 {
+			t.Fatalf("move due again: got %d (%v), want 0", moved, err)
+		}
+
+		entries, err := transport.Read(ctx, "s", "0-0", 10, 0)
+		if err != nil || len(entries) != 1 {
+			t.Fatalf("moved entries: got %v (%v), want 1", entries, err)
+		}
+		// The entry keeps its binary payload and nothing but its own fields
+		if got := entries[0].Values; len(got) != 1 || got["p"] != payload {
+			t.Fatalf("moved entry values: got %q", got)
+		}
+	})
+}
+
+func TestTransportScheduleAppliesMaxLen(t *testing.T) {
+	forEachTransport(t, func(t *testing.T, transport bus.Transport) {
+		ctx := t.Context()
+		now := time.Now()
+		for i, p := range []string{"1", "2", "3"} {
+			at := now.Add(time.Duration(i-3) * time.Second)
+			if err := transport.Schedule(ctx, "s", map[string]interface{}{"p": p}, at, 2); err != nil {
+				t.Fatalf("schedule entry %s: %v", p, err)
+			}
+		}
+		if moved, _, err := transport.MoveDue(ctx, now, 10); err != nil || moved != 3 {
+			t.Fatalf("move due: got %d (%v), want 3", moved, err)
+		}
+
+		entries, err := transport.Read(ctx, "s", "0-0", 10, 0)
+		if err != nil || len(entries) != 2 {
+			t.Fatalf("stream after move: got %v (%v), want the last 2 entries", entries, err)
+		}
+		if got := entries[1].Values; len(got) != 1 || got["p"] != "3" {
+			t.Fatalf("moved entry values: got %q, want the entry fields only", got)
+		}
+	})
+}
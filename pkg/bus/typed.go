@@ -0,0 +1,117 @@
+package bus
+
+import (
+	"context"
+	"fmt"
+	"iter"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+// Named is implemented by typed messages that know the stream they are sent to
+type Named interface {
+	String() string
+}
+
+// typedHandler adapts a typed handler function to the Subscriber interface
+type typedHandler[Q, R any] struct {
+	query Q
+	fn    func(ctx context.Context, q Q) (R, error)
+}
+
+// Handle implements Subscriber
+func (h *typedHandler[Q, R]) Handle(ctx context.Context) (any, error) {
+	return h.fn(ctx, h.query)
+}
+
+// Handle registers a typed handler for the stream
+// Properties are decoded into Q and the returned R is encoded into the response
+func Handle[Q, R any](factory *HandlerFactory, streamName string, fn func(ctx context.Context, q Q) (R, error)) {
+	factory.RegisterHandler(streamName, func(data []byte, _ Repository) (Subscriber, error) {
+		var q Q
+		if len(data) > 0 {
+			if err := cbor.Unmarshal(data, &q); err != nil {
+				return nil, fmt.Errorf("failed to decode %T: %w", q, err)
+			}
+		}
+		return &typedHandler[Q, R]{query: q, fn: fn}, nil
+	})
+}
+
+// HandleWith registers a typed handler that receives typed dependencies
+// Use it instead of RegisterRepository to avoid type assertions on Repository
+func HandleWith[D, Q, R any](factory *HandlerFactory, streamName string, deps D, fn func(ctx context.Context, deps D, q Q) (R, error)) {
+	Handle(factory, streamName, func(ctx context.Context, q Q) (R, error) {
+		return fn(ctx, deps, q)
+	})
+}
+
+// typedPublisher adapts a typed message to the Publisher interface
+type typedPublisher[Q Named] struct {
+	msg Q
+}
+
+// String returns the stream name of the message
+func (p typedPublisher[Q]) String() string {
+	return p.msg.String()
+}
+
+// Serialize encodes the message to CBOR
+func (p typedPublisher[Q]) Serialize() ([]byte, error) {
+	return cbor.Marshal(p.msg)
+}
+
+// MessageInfo returns the class metadata of the message when it implements Describer
+func (p typedPublisher[Q]) MessageInfo() MessageInfo {
+	if describer, ok := any(p.msg).(Describer); ok {
+		return describer.MessageInfo()
+	}
+	return MessageInfo{}
+}
+
+// publisherOf returns the message itself when it already implements Publisher
+func publisherOf[Q Named](msg Q) Publisher {
+	if pub, ok := any(msg).(Publisher); ok {
+		return pub
+	}
+	return typedPublisher[Q]{msg: msg}
+}
+
+// Call sends a typed query to its stream and decodes the result into R
+// The handler error is returned as the error of the call
+func Call[Q Named, R any](ctx context.Context, b *Bus, q Q, opts ...CallOption) (R, error) {
+	var result R
+
+	resp, err := b.Execute(ctx, publisherOf(q), opts...)
+	if err != nil {
+		return result, err
+	}
+	if resp.Error != nil {
+		return result, resp.Error
+	}
+	if err := resp.Decode(&result); err != nil {
+		return result, fmt.Errorf("failed to decode %T: %w", result, err)
+	}
+	return result, nil
+}
+
+// CallStream sends a typed query to its stream and yields the chunks sent by the handler, then its final result
+// Every chunk and the result are decoded into R, the handler error ends the sequence as an error
+func CallStream[Q Named, R any](ctx context.Context, b *Bus, q Q, opts ...CallOption) iter.Seq2[R, error] {
+	return func(yield func(R, error) bool) {
+		for resp, err := range b.ExecuteStream(ctx, publisherOf(q), opts...) {
+			var result R
+			if err == nil {
+				err = resp.Error
+			}
+			if err == nil {
+				if decodeErr := resp.Decode(&result); decodeErr != nil {
+					err = fmt.Errorf("failed to decode %T: %w", result, decodeErr)
+				}
+			}
+			if !yield(result, err) || err != nil {
+				return
+			}
+		}
+	}
+}
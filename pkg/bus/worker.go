@@ -0,0 +1,118 @@
+package bus
+
+import (
+	"context"
+	"maps"
+	"slices"
+	"sync"
+)
+
+// workerPool bounds the number of entries of a single stream handled concurrently
+// A free slot, and a slot of the global limiter, is reserved before reading,
+// so the bus stops reading when all workers are busy and never holds entries it cannot start
+type workerPool struct {
+	slots  chan struct{}
+	global chan struct{}
+	wg     sync.WaitGroup
+
+	mu sync.Mutex
+	// running holds the IDs of entries handed to workers and not finished yet
+	running map[string]struct{}
+}
+
+// newWorkerPool creates a pool with the given number of workers
+// global is the bus-wide limiter shared by all streams, nil means no limit
+func newWorkerPool(workers int, global chan struct{}) *workerPool {
+	return &workerPool{
+		slots:   make(chan struct{}, max(workers, 1)),
+		global:  global,
+		running: make(map[string]struct{}),
+	}
+}
+
+// reserve blocks until at least one worker and one global slot are free and reserves up to limit of each
+// Returns the number of reserved workers, zero when the context is done
+func (p *workerPool) reserve(ctx context.Context, limit int) int {
+	reserved := acquire(ctx, p.slots, limit)
+	if reserved == 0 || p.global == nil {
+		return reserved
+	}
+
+	granted := acquire(ctx, p.global, reserved)
+	for range reserved - granted {
+		<-p.slots
+	}
+	return granted
+}
+
+// acquire blocks until one slot of the semaphore is free and takes up to limit slots
+// Returns the number of taken slots, zero when the context is done
+func acquire(ctx context.Context, sem chan struct{}, limit int) int {
+	if ctx.Err() != nil {
+		return 0
+	}
+	select {
+	case sem <- struct{}{}:
+	case <-ctx.Done():
+		return 0
+	}
+
+	taken := 1
+	for taken < limit {
+		select {
+		case sem <- struct{}{}:
+			taken++
+		default:
+			return taken
+		}
+	}
+	return taken
+}
+
+// release frees reserved workers that got no entry to handle
+func (p *workerPool) release(n int) {
+	for range n {
+		<-p.slots
+		if p.global != nil {
+			<-p.global
+		}
+	}
+}
+
+// run handles an entry on a reserved worker and frees the worker afterwards
+func (p *workerPool) run(id string, fn func()) {
+	p.mu.Lock()
+	p.running[id] = struct{}{}
+	p.mu.Unlock()
+
+	p.wg.Go(func() {
+		defer p.release(1)
+		defer func() {
+			p.mu.Lock()
+			delete(p.running, id)
+			p.mu.Unlock()
+		}()
+
+		fn()
+	})
+}
+
+// isRunning reports whether the entry is being handled by a worker of the pool
+func (p *workerPool) isRunning(id string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	_, ok := p.running[id]
+	return ok
+}
+
+// runningIDs returns the IDs of entries being handled, sorted
+func (p *workerPool) runningIDs() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return slices.Sorted(maps.Keys(p.running))
+}
+
+// wait blocks until every running entry is handled
+func (p *workerPool) wait() {
+	p.wg.Wait()
+}
@@ -0,0 +1,70 @@
+package bus
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestWorkerPoolReservesGlobalSlotsBeforeRead(t *testing.T) {
+	global := make(chan struct{}, 2)
+	first := newWorkerPool(4, global)
+	second := newWorkerPool(4, global)
+
+	if got := first.reserve(t.Context(), 4); got != 2 {
+		t.Fatalf("reserve: got %d workers, want 2 limited by the global limit", got)
+	}
+	if got := len(first.slots); got != 2 {
+		t.Fatalf("stream slots held: got %d, want 2", got)
+	}
+
+	ctx, cancel := context.WithTimeout(t.Context(), 20*time.Millisecond)
+	defer cancel()
+	if got := second.reserve(ctx, 4); got != 0 {
+		t.Fatalf("reserve over the global limit: got %d workers, want 0", got)
+	}
+	if got := len(second.slots); got != 0 {
+		t.Fatalf("stream slots leaked after a failed reserve: %d", got)
+	}
+
+	first.release(1)
+	if got := second.reserve(t.Context(), 4); got != 1 {
+		t.Fatalf("reserve after release: got %d workers, want 1", got)
+	}
+}
+
+func TestWorkerPoolTracksRunningEntries(t *testing.T) {
+	pool := newWorkerPool(2, nil)
+	if got := pool.reserve(t.Context(), 2); got != 2 {
+		t.Fatalf("reserve: got %d workers, want 2", got)
+	}
+
+	release := make(chan struct{})
+	pool.run("1-0", func() { <-release })
+	pool.run("2-0", func() {})
+
+	// The second entry finishes right away, the first one keeps running
+	deadline := time.Now().Add(time.Second)
+	for pool.isRunning("2-0") {
+		if time.Now().After(deadline) {
+			t.Fatal("finished entry is still tracked")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if !pool.isRunning("1-0") {
+		t.Fatal("running entry is not tracked")
+	}
+	if got := pool.runningIDs(); !slices.Equal(got, []string{"1-0"}) {
+		t.Fatalf("running IDs: got %v", got)
+	}
+
+	close(release)
+	pool.wait()
+	if got := pool.runningIDs(); len(got) != 0 {
+		t.Fatalf("running IDs after wait: got %v", got)
+	}
+	if got := len(pool.slots); got != 0 {
+		t.Fatalf("workers not freed: %d", got)
+	}
+}
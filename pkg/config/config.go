@@ -2,9 +2,11 @@ package config
 
 import (
 	"fmt"
-	"log"
+	"log/slog"
 	"os"
+	"time"
 
+	"github.com/PavelRadostev/toolkit/pkg/bus"
 	"github.com/ilyakaznacheev/cleanenv"
 )
 
@@ -28,22 +30,101 @@ type Config struct {
 	Migration struct {
 		Dir string `yaml:"dir"`
 	} `yaml:"migration"`
+	Bus BusConfig `yaml:"bus"`
+	Log LogConfig `yaml:"log"`
 }
 
+// LogConfig holds logging settings
+type LogConfig struct {
+	// Level is the minimum level: debug, info, warn or error; info when empty
+	Level slog.Level `yaml:"level"`
+	// Format is "json" or "text", text when empty
+	Format string `yaml:"format"`
+}
+
+// NewLogger creates a logger writing to stderr with the configured level and format
+func (c LogConfig) NewLogger() *slog.Logger {
+	opts := &slog.HandlerOptions{Level: c.Level}
+	if c.Format == "json" {
+		return slog.New(slog.NewJSONHandler(os.Stderr, opts))
+	}
+	return slog.New(slog.NewTextHandler(os.Stderr, opts))
+}
+
+// logger reports Load failures, nil means slog.Default()
+var logger *slog.Logger
+
+// SetLogger sets the logger used by Load, nil means slog.Default()
+func SetLogger(l *slog.Logger) {
+	logger = l
+}
+
+// fatal logs the message at the error level and exits
+func fatal(msg string, args ...any) {
+	l := logger
+	if l == nil {
+		l = slog.Default()
+	}
+	l.Error(msg, args...)
+	os.Exit(1)
+}
+
+// BusConfig holds bus settings
+type BusConfig struct {
+	// Retention applies to every stream without its own settings
+	Retention RetentionConfig `yaml:"retention"`
+	// Streams holds per-stream settings keyed by stream name
+	Streams map[string]BusStreamConfig `yaml:"streams"`
+}
+
+// Apply sets the retention policies of the config on the bus
+func (c BusConfig) Apply(b *bus.Bus) {
+	b.SetRetention(c.Retention.Policy())
+	for streamName, streamCfg := range c.Streams {
+		b.SetStreamRetention(streamName, streamCfg.Retention.Policy())
+	}
+}
+
+// BusStreamConfig holds settings of a single stream
+type BusStreamConfig struct {
+	Retention RetentionConfig `yaml:"retention"`
+}
+
+// RetentionConfig describes how long stream entries are kept
+type RetentionConfig struct {
+	// MaxLen caps the stream length on every add, approximately, zero disables it
+	// It drops entries consumers have not read yet, so it is opt-in
+	MaxLen int64 `yaml:"max_len"`
+	// MaxAge is how long entries are kept, e.g. "168h"
+	MaxAge time.Duration `yaml:"max_age"`
+	// TrimInterval is how often entries older than MaxAge are trimmed
+	TrimInterval time.Duration `yaml:"trim_interval"`
+}
+
+// Policy converts the settings into a bus.RetentionPolicy
+func (c RetentionConfig) Policy() bus.RetentionPolicy {
+	return bus.RetentionPolicy{
+		MaxLen:       c.MaxLen,
+		MaxAge:       c.MaxAge,
+		TrimInterval: c.TrimInterval,
+	}
+}
+
+// Load reads the config file from CONFIG_PATH and exits the process when it cannot
 func Load() *Config {
 	configPath := os.Getenv("CONFIG_PATH")
 	if configPath == "" {
-		log.Fatal("CONFIG_PATH is not set")
+		fatal("CONFIG_PATH is not set")
 	}
 
 	if _, err := os.Stat(configPath); os.IsNotExist(err) {
-		log.Fatalf("config file does not exist: %s", configPath)
+		fatal("Config file does not exist", "path", configPath)
 	}
 
 	var cfg Config
 
 	if err := cleanenv.ReadConfig(configPath, &cfg); err != nil {
-		log.Fatalf("cannot read congig: %s", err)
+		fatal("Cannot read config", "path", configPath, "error", err)
 	}
 
 	return &cfg
@@ -0,0 +1,62 @@
+package config
+
+import (
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/PavelRadostev/toolkit/pkg/bus"
+)
+
+// loadYAML writes the YAML to a temporary config file and loads it
+func loadYAML(t *testing.T, yaml string) *Config {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "settings.yaml")
+	if err := os.WriteFile(path, []byte(yaml), 0o600); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	t.Setenv("CONFIG_PATH", path)
+	return Load()
+}
+
+func TestLoadLogSettings(t *testing.T) {
+	cfg := loadYAML(t, "log:\n  level: debug\n  format: json\n")
+	if cfg.Log.Level != slog.LevelDebug || cfg.Log.Format != "json" {
+		t.Fatalf("log settings: got %+v", cfg.Log)
+	}
+
+	cfg = loadYAML(t, "redis:\n  addr: localhost:6379\n")
+	if cfg.Log.Level != slog.LevelInfo || cfg.Log.Format != "" {
+		t.Fatalf("default log settings: got %+v, want info level", cfg.Log)
+	}
+}
+
+func TestLoadBusRetention(t *testing.T) {
+	cfg := loadYAML(t, `
+bus:
+  retention:
+    max_age: 168h
+    trim_interval: 5m
+  streams:
+    plans:
+      retention:
+        max_len: 1000
+`)
+	if got := cfg.Bus.Retention; got.MaxAge != 168*time.Hour || got.TrimInterval != 5*time.Minute || got.MaxLen != 0 {
+		t.Fatalf("bus retention: got %+v", got)
+	}
+	if got := cfg.Bus.Streams["plans"].Retention.MaxLen; got != 1000 {
+		t.Fatalf("stream max_len: got %d, want 1000", got)
+	}
+}
+
+func TestRetentionPolicy(t *testing.T) {
+	cfg := RetentionConfig{MaxLen: 1000, MaxAge: time.Hour, TrimInterval: time.Minute}
+	want := bus.RetentionPolicy{MaxLen: 1000, MaxAge: time.Hour, TrimInterval: time.Minute}
+	if got := cfg.Policy(); got != want {
+		t.Fatalf("policy: got %+v, want %+v", got, want)
+	}
+}
@@ -1,13 +1,35 @@
 package migrator
 
 import (
-	"fmt"
-	"log"
+	"log/slog"
+	"os"
 
 	"github.com/golang-migrate/migrate/v4"
 	"github.com/spf13/cobra"
 )
 
+// logger reports migration progress and failures, nil means slog.Default()
+var logger *slog.Logger
+
+// SetLogger sets the logger of the migration CLI, nil means slog.Default()
+func SetLogger(l *slog.Logger) {
+	logger = l
+}
+
+// log returns the configured logger
+func log() *slog.Logger {
+	if logger == nil {
+		return slog.Default()
+	}
+	return logger
+}
+
+// fatal logs the message at the error level and exits
+func fatal(msg string, err error) {
+	log().Error(msg, "error", err)
+	os.Exit(1)
+}
+
 var rootCmd = &cobra.Command{
 	Use:   "migrate",
 	Short: "Database migration CLI",
@@ -18,19 +40,19 @@ var upCmd = &cobra.Command{
 	Use:   "up",
 	Short: "Apply all up migrations",
 	Run: func(cmd *cobra.Command, args []string) {
-		fmt.Println("Running up migrations...")
+		log().Info("Running up migrations")
 		m, err := getMigrator()
 		if err != nil {
-			log.Fatalf("❌ Failed to create migrator: %v", err)
+			fatal("Failed to create migrator", err)
 		}
 
 		err = m.Up()
 		if err != nil && err != migrate.ErrNoChange {
-			log.Fatalf("❌ Migration up failed: %v", err)
+			fatal("Migration up failed", err)
 		}
 
 		version, dirty, _ := m.Version()
-		fmt.Printf("✅ Migrated to version %d (dirty: %v)\n", version, dirty)
+		log().Info("Migrated", "version", version, "dirty", dirty)
 	},
 }
 
@@ -40,16 +62,16 @@ var downCmd = &cobra.Command{
 	Run: func(cmd *cobra.Command, args []string) {
 		m, err := getMigrator()
 		if err != nil {
-			log.Fatalf("❌ Failed to create migrator: %v", err)
+			fatal("Failed to create migrator", err)
 		}
 
 		err = m.Steps(-1)
 		if err != nil {
-			log.Fatalf("❌ Migration down failed: %v", err)
+			fatal("Migration down failed", err)
 		}
 
 		version, dirty, _ := m.Version()
-		fmt.Printf("⬅️  Rolled back to version %d (dirty: %v)\n", version, dirty)
+		log().Info("Rolled back", "version", version, "dirty", dirty)
 	},
 }
 
@@ -59,25 +81,25 @@ var versionCmd = &cobra.Command{
 	Run: func(cmd *cobra.Command, args []string) {
 		m, err := getMigrator()
 		if err != nil {
-			log.Fatalf("❌ Failed to create migrator: %v", err)
+			fatal("Failed to create migrator", err)
 		}
 
 		version, dirty, err := m.Version()
 		if err != nil {
-			fmt.Printf("⚠️  Could not get version: %v\n", err)
+			log().Warn("Could not get version", "error", err)
 		} else {
-			fmt.Printf("📦 Current version: %d (dirty: %v)\n", version, dirty)
+			log().Info("Current version", "version", version, "dirty", dirty)
 		}
 	},
 }
 
 // Execute запускает корневую команду
 func Execute() {
-	fmt.Println("Starting database migration...")
+	log().Debug("Starting database migration CLI")
 	rootCmd.AddCommand(upCmd)
 	rootCmd.AddCommand(downCmd)
 	rootCmd.AddCommand(versionCmd)
 	if err := rootCmd.Execute(); err != nil {
-		log.Fatalf("❌ Failed to execute command: %v", err)
+		fatal("Failed to execute command", err)
 	}
 }